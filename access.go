@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/rs/zerolog"
+)
+
+// IndexAccessConfig restricts the indices, aliases and data streams the tools
+// may touch. Patterns use Elasticsearch's "*" wildcard. A name is permitted
+// when it matches an allow pattern (or the allowlist is empty) and does not
+// match any deny pattern.
+type IndexAccessConfig struct {
+	Allow []string `yaml:"allow,omitempty"`
+	Deny  []string `yaml:"deny,omitempty"`
+}
+
+// IndexAccessError is returned when a tool call targets an index that is not
+// permitted. It never names the hidden indices a pattern expanded to.
+type IndexAccessError struct {
+	Expression string
+	Name       string
+}
+
+func (e *IndexAccessError) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("access to index %q is not permitted", e.Name)
+	}
+	return fmt.Sprintf(
+		"index expression %q matches indices that are not permitted; use a narrower pattern",
+		e.Expression,
+	)
+}
+
+type indexAccess struct {
+	allow []string
+	deny  []string
+}
+
+func newIndexAccess(cfg IndexAccessConfig) *indexAccess {
+	return &indexAccess{allow: cfg.Allow, deny: cfg.Deny}
+}
+
+func (a *indexAccess) enabled() bool {
+	return a != nil && (len(a.allow) > 0 || len(a.deny) > 0)
+}
+
+// permitted reports whether name may be accessed.
+func (a *indexAccess) permitted(name string) bool {
+	if !a.enabled() {
+		return true
+	}
+	for _, pattern := range a.deny {
+		if globMatch(pattern, name) {
+			return false
+		}
+	}
+	if len(a.allow) == 0 {
+		return true
+	}
+	for _, pattern := range a.allow {
+		if globMatch(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLiterals checks the literal names of an index expression such as
+// "logs-*,metrics" as given, so that denied names are rejected whether or not
+// they exist. Wildcard patterns and exclusions are skipped.
+func (a *indexAccess) checkLiterals(expression string) error {
+	if !a.enabled() {
+		return nil
+	}
+
+	for _, part := range splitList(expression) {
+		if strings.HasPrefix(part, "-") || isIndexPattern(part) {
+			continue
+		}
+		if !a.permitted(part) {
+			return &IndexAccessError{Expression: expression, Name: part}
+		}
+	}
+
+	return nil
+}
+
+// check verifies an index expression against the access rules. Besides its
+// literal names, the expression is resolved on the cluster and every index,
+// alias and data stream it expands to, including the indices behind aliases,
+// must be permitted as well.
+func (a *indexAccess) check(ctx context.Context, c *cluster, expression string) error {
+	if !a.enabled() {
+		return nil
+	}
+
+	if err := a.checkLiterals(expression); err != nil {
+		return err
+	}
+
+	names, err := c.resolveIndex(ctx, expression)
+	if err != nil {
+		return fmt.Errorf("failed to resolve index expression %q: %w", expression, err)
+	}
+	for _, name := range names {
+		if !a.permitted(name) {
+			return &IndexAccessError{Expression: expression}
+		}
+	}
+
+	return nil
+}
+
+// isIndexPattern reports whether part of an index expression can expand to
+// more than one name.
+func isIndexPattern(part string) bool {
+	return part == "_all" || strings.Contains(part, "*")
+}
+
+// globMatch matches name against a pattern in which "*" matches any sequence
+// of characters, the only wildcard Elasticsearch index patterns support.
+func globMatch(pattern, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == name
+	}
+
+	if !strings.HasPrefix(name, parts[0]) {
+		return false
+	}
+	name = name[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(name, part)
+		if i < 0 {
+			return false
+		}
+		name = name[i+len(part):]
+	}
+
+	return len(name) >= len(last) && strings.HasSuffix(name, last)
+}
+
+type resolveIndexResponse struct {
+	Indices []struct {
+		Name       string   `json:"name"`
+		Aliases    []string `json:"aliases"`
+		DataStream string   `json:"data_stream"`
+	} `json:"indices"`
+	Aliases []struct {
+		Name    string   `json:"name"`
+		Indices []string `json:"indices"`
+	} `json:"aliases"`
+	DataStreams []struct {
+		Name string `json:"name"`
+	} `json:"data_streams"`
+}
+
+// resolveIndex returns the names an index expression expands to: the
+// matching indices, aliases and data streams, and the indices behind each
+// alias. Backing indices are reported by their data stream's name. An
+// expression that matches nothing resolves to no names.
+func (c *cluster) resolveIndex(ctx context.Context, expression string) ([]string, error) {
+	resolved, err := c.resolve(ctx, expression)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, idx := range resolved.Indices {
+		names = append(names, accessName(idx.Name, idx.DataStream))
+	}
+	for _, alias := range resolved.Aliases {
+		names = append(names, alias.Name)
+		names = append(names, alias.Indices...)
+	}
+	for _, ds := range resolved.DataStreams {
+		names = append(names, ds.Name)
+	}
+
+	return names, nil
+}
+
+// dataStreams maps the backing indices an index expression expands to to
+// their data stream.
+func (c *cluster) dataStreams(ctx context.Context, expression string) (map[string]string, error) {
+	resolved, err := c.resolve(ctx, expression)
+	if err != nil {
+		return nil, err
+	}
+
+	streams := make(map[string]string)
+	for _, idx := range resolved.Indices {
+		if idx.DataStream != "" {
+			streams[idx.Name] = idx.DataStream
+		}
+	}
+	return streams, nil
+}
+
+// indexNames maps each of the concrete indices to its data stream and its
+// aliases.
+func (c *cluster) indexNames(ctx context.Context, indices []string) (indexNames, error) {
+	resolved, err := c.resolve(ctx, strings.Join(indices, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(indexNames)
+	for _, idx := range resolved.Indices {
+		other := append([]string(nil), idx.Aliases...)
+		if idx.DataStream != "" {
+			other = append(other, idx.DataStream)
+		}
+		names[idx.Name] = other
+	}
+	return names, nil
+}
+
+// accessName is the name the access rules judge an index by: the data
+// stream of a backing index, or the index's own name.
+func accessName(index, dataStream string) string {
+	if dataStream != "" {
+		return dataStream
+	}
+	return index
+}
+
+// resolve runs the resolve index API on an index expression. An expression
+// that matches nothing resolves to an empty response.
+func (c *cluster) resolve(ctx context.Context, expression string) (*resolveIndexResponse, error) {
+	if expression == "" {
+		expression = "*"
+	}
+
+	res, err := c.client.Indices.ResolveIndex(
+		strings.Split(expression, ","),
+		c.client.Indices.ResolveIndex.WithContext(ctx),
+		c.client.Indices.ResolveIndex.WithExpandWildcards("all"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var resolved resolveIndexResponse
+	if res.StatusCode == http.StatusNotFound {
+		return &resolved, nil
+	}
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&resolved); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &resolved, nil
+}
+
+// checkIndexAccess applies the index access rules to a tool call. It returns
+// the tool error to send back when the call must be rejected, or nil.
+func (h *ElasticsearchHandler) checkIndexAccess(
+	ctx context.Context,
+	log zerolog.Logger,
+	c *cluster,
+	expression string,
+) *mcp.CallToolResult {
+	err := h.indexAccess.check(ctx, c, expression)
+	if err == nil {
+		return nil
+	}
+
+	var accessErr *IndexAccessError
+	if errors.As(err, &accessErr) {
+		log.Warn().Str("index", expression).Msg("Index access denied")
+	} else {
+		log.Error().Err(err).Str("index", expression).Msg("Failed to check index access")
+	}
+	return mcp.NewToolResultError(err.Error())
+}
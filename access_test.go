@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// newTestCluster returns a cluster whose Elasticsearch is served by handler.
+func newTestCluster(t *testing.T, handler http.HandlerFunc) *cluster {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return &cluster{name: "test", endpoint: server.URL, client: client}
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"logs", "logs", true},
+		{"logs", "logs-1", false},
+		{"logs-*", "logs-2024", true},
+		{"logs-*", "logs-", true},
+		{"logs-*", "metrics-2024", false},
+		{"*", "anything", true},
+		{"*-prod", "logs-prod", true},
+		{"*-prod", "logs-prod-1", false},
+		{"logs-*-prod", "logs-eu-prod", true},
+		{"logs-*-prod", "logs-prod", false},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxcyyb", false},
+		{"ab*ba", "aba", false},
+		{".ds-*", ".ds-logs-2024.01.01-000001", true},
+	}
+
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIndexAccessPermitted(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    IndexAccessConfig
+		index  string
+		wanted bool
+	}{
+		{"no rules", IndexAccessConfig{}, "secret", true},
+		{"allowed", IndexAccessConfig{Allow: []string{"logs-*"}}, "logs-app", true},
+		{"not allowed", IndexAccessConfig{Allow: []string{"logs-*"}}, "users", false},
+		{"denied", IndexAccessConfig{Deny: []string{"secret*"}}, "secret-keys", false},
+		{"deny wins over allow", IndexAccessConfig{Allow: []string{"*"}, Deny: []string{"secret*"}}, "secret", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newIndexAccess(tt.cfg).permitted(tt.index); got != tt.wanted {
+				t.Errorf("permitted(%q) = %v, want %v", tt.index, got, tt.wanted)
+			}
+		})
+	}
+}
+
+func TestIndexAccessCheck(t *testing.T) {
+	const resolved = `{
+		"indices": [
+			{"name": "logs-app", "attributes": ["open"]},
+			{"name": ".ds-secret-stream-2024.01.01-000001", "data_stream": "secret-stream"},
+			{"name": ".ds-logs-stream-2024.01.01-000001", "data_stream": "logs-stream"}
+		],
+		"aliases": [{"name": "logs-all", "indices": ["logs-app", "users"]}],
+		"data_streams": [{"name": "logs-stream", "backing_indices": [".ds-logs-stream-2024.01.01-000001"]}]
+	}`
+	responses := map[string]string{
+		"/_resolve/index/logs-app":    `{"indices": [{"name": "logs-app"}], "aliases": [], "data_streams": []}`,
+		"/_resolve/index/logs-stream": `{"indices": [{"name": ".ds-logs-stream-2024.01.01-000001", "data_stream": "logs-stream"}], "aliases": [], "data_streams": [{"name": "logs-stream"}]}`,
+		"/_resolve/index/logs-all":    `{"indices": [], "aliases": [{"name": "logs-all", "indices": ["logs-app", "users"]}], "data_streams": []}`,
+		"/_resolve/index/*":           resolved,
+	}
+	c := newTestCluster(t, func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error": "index_not_found_exception"}`))
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	})
+
+	access := newIndexAccess(IndexAccessConfig{Allow: []string{"logs-*"}, Deny: []string{"secret*"}})
+
+	tests := []struct {
+		expression string
+		wantName   string // literal name reported as denied
+		wantErr    bool
+	}{
+		{expression: "logs-app"},
+		{expression: "logs-stream"},
+		{expression: "logs-missing"},
+		{expression: "secret", wantErr: true, wantName: "secret"},
+		{expression: "logs-app,-secret"},
+		{expression: "logs-all", wantErr: true},
+		{expression: "*", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			err := access.check(context.Background(), c, tt.expression)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("check(%q) = %v, want nil", tt.expression, err)
+				}
+				return
+			}
+
+			var accessErr *IndexAccessError
+			if !errors.As(err, &accessErr) {
+				t.Fatalf("check(%q) = %v, want an IndexAccessError", tt.expression, err)
+			}
+			if accessErr.Name != tt.wantName {
+				t.Errorf("check(%q) named %q, want %q", tt.expression, accessErr.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestClusterDataStreams(t *testing.T) {
+	c := newTestCluster(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"indices": [
+			{"name": "logs-app"},
+			{"name": ".ds-secret-2024.01.01-000001", "data_stream": "secret"}
+		]}`))
+	})
+
+	streams, err := c.dataStreams(context.Background(), "*")
+	if err != nil {
+		t.Fatalf("dataStreams() error = %v", err)
+	}
+
+	access := newIndexAccess(IndexAccessConfig{Deny: []string{"secret*"}})
+	if access.permitted(accessName(".ds-secret-2024.01.01-000001", streams[".ds-secret-2024.01.01-000001"])) {
+		t.Error("backing index of a denied data stream is permitted")
+	}
+	if !access.permitted(accessName("logs-app", streams["logs-app"])) {
+		t.Error("plain index is not permitted")
+	}
+
+	allow := newIndexAccess(IndexAccessConfig{Allow: []string{"secret"}})
+	if !allow.permitted(accessName(".ds-secret-2024.01.01-000001", streams[".ds-secret-2024.01.01-000001"])) {
+		t.Error("backing index of an allowed data stream is not permitted")
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var errUnknownAsyncTask = errors.New("unknown or expired search id, run the search again")
+
+// AsyncConfig configures searches that keep running in Elasticsearch after
+// the tool call returns.
+type AsyncConfig struct {
+	// WaitForCompletion is how long a call waits for results before
+	// returning an id to poll. Callers may ask for a different wait, up to
+	// the query budget timeout.
+	WaitForCompletion time.Duration `yaml:"wait_for_completion"`
+	// KeepAlive is how long Elasticsearch keeps a running search and its
+	// results after the last poll.
+	KeepAlive time.Duration `yaml:"keep_alive"`
+	// MaxRunning caps the number of async searches running at once.
+	MaxRunning int `yaml:"max_running"`
+}
+
+// asyncTask is an async search running in Elasticsearch.
+type asyncTask struct {
+	id       string
+	tool     string
+	clientID string
+	cluster  string
+	index    string
+	// params holds the tool specific parameters needed to render the
+	// results once they are polled.
+	params map[string]string
+	// body is the search body, used to redact the aggregations of the
+	// results.
+	body    map[string]any
+	expires time.Time
+}
+
+// asyncTaskStore keeps track of the async searches started through the
+// server. Every client shares the server's Elasticsearch credentials, so the
+// store is what keeps a client from reading another client's searches.
+type asyncTaskStore struct {
+	cfg AsyncConfig
+
+	mu    sync.Mutex
+	tasks map[string]*asyncTask
+}
+
+func newAsyncTaskStore(cfg AsyncConfig) *asyncTaskStore {
+	return &asyncTaskStore{cfg: cfg, tasks: make(map[string]*asyncTask)}
+}
+
+// get returns a task of tool started by clientID.
+func (s *asyncTaskStore) get(id, tool, clientID string) (*asyncTask, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, ok := s.tasks[id]
+	if !ok || task.tool != tool || task.clientID != clientID || time.Now().After(task.expires) {
+		return nil, errUnknownAsyncTask
+	}
+	return task, nil
+}
+
+func (s *asyncTaskStore) put(task *asyncTask) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweepLocked()
+	if _, ok := s.tasks[task.id]; !ok && len(s.tasks) >= s.cfg.MaxRunning {
+		return fmt.Errorf("too many async searches running (maximum %d)", s.cfg.MaxRunning)
+	}
+	task.expires = time.Now().Add(s.cfg.KeepAlive)
+	s.tasks[task.id] = task
+	return nil
+}
+
+func (s *asyncTaskStore) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.tasks, id)
+}
+
+// sweepLocked forgets the tasks that expired. Elasticsearch deletes them on
+// its own once their keep-alive lapses.
+func (s *asyncTaskStore) sweepLocked() {
+	now := time.Now()
+	for id, task := range s.tasks {
+		if now.After(task.expires) {
+			delete(s.tasks, id)
+		}
+	}
+}
+
+// waitForCompletion returns how long a call waits for an async search,
+// bounded by the call's budget timeout.
+func (cfg AsyncConfig) waitForCompletion(requested string, budget queryBudget) (time.Duration, error) {
+	wait := cfg.WaitForCompletion
+	if requested != "" {
+		d, err := time.ParseDuration(requested)
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf(
+				"invalid wait_for_completion_timeout %q, expected a duration such as 10s", requested,
+			)
+		}
+		wait = d
+	}
+	if budget.Timeout > 0 && wait > budget.Timeout {
+		wait = budget.Timeout
+	}
+	return wait, nil
+}
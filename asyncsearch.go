@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/rs/zerolog"
+)
+
+// asyncProgressInterval is how often the status of an async search is
+// checked to report progress to clients that asked for it.
+const asyncProgressInterval = 2 * time.Second
+
+type AsyncSearchResponse struct {
+	ID                     string          `json:"id"`
+	IsRunning              bool            `json:"is_running"`
+	IsPartial              bool            `json:"is_partial"`
+	StartTimeInMillis      int64           `json:"start_time_in_millis"`
+	ExpirationTimeInMillis int64           `json:"expiration_time_in_millis"`
+	Response               *SearchResponse `json:"response"`
+}
+
+type asyncSearchStatus struct {
+	IsRunning bool `json:"is_running"`
+	Shards    struct {
+		Total      int `json:"total"`
+		Successful int `json:"successful"`
+		Skipped    int `json:"skipped"`
+		Failed     int `json:"failed"`
+	} `json:"_shards"`
+}
+
+func (c *cluster) submitAsyncSearch(
+	ctx context.Context,
+	index string,
+	body []byte,
+	wait time.Duration,
+	keepAlive time.Duration,
+	trackTotalHits bool,
+) (*AsyncSearchResponse, error) {
+	res, err := c.client.AsyncSearch.Submit(
+		c.client.AsyncSearch.Submit.WithContext(ctx),
+		c.client.AsyncSearch.Submit.WithIndex(index),
+		c.client.AsyncSearch.Submit.WithBody(strings.NewReader(string(body))),
+		c.client.AsyncSearch.Submit.WithWaitForCompletionTimeout(wait),
+		c.client.AsyncSearch.Submit.WithKeepAlive(keepAlive),
+		c.client.AsyncSearch.Submit.WithKeepOnCompletion(true),
+		c.client.AsyncSearch.Submit.WithTrackTotalHits(trackTotalHits),
+	)
+	return decodeAsyncSearch(res, err)
+}
+
+func (c *cluster) getAsyncSearch(
+	ctx context.Context,
+	id string,
+	wait time.Duration,
+	keepAlive time.Duration,
+) (*AsyncSearchResponse, error) {
+	options := []func(*esapi.AsyncSearchGetRequest){
+		c.client.AsyncSearch.Get.WithContext(ctx),
+		c.client.AsyncSearch.Get.WithKeepAlive(keepAlive),
+	}
+	if wait > 0 {
+		options = append(options, c.client.AsyncSearch.Get.WithWaitForCompletionTimeout(wait))
+	}
+	res, err := c.client.AsyncSearch.Get(id, options...)
+	return decodeAsyncSearch(res, err)
+}
+
+func decodeAsyncSearch(res *esapi.Response, err error) (*AsyncSearchResponse, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var asyncResponse AsyncSearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&asyncResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &asyncResponse, nil
+}
+
+func (c *cluster) asyncSearchStatus(ctx context.Context, id string) (*asyncSearchStatus, error) {
+	res, err := c.client.AsyncSearch.Status(id, c.client.AsyncSearch.Status.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var status asyncSearchStatus
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &status, nil
+}
+
+func (c *cluster) deleteAsyncSearch(ctx context.Context, id string) error {
+	res, err := c.client.AsyncSearch.Delete(id, c.client.AsyncSearch.Delete.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+	return nil
+}
+
+// progressToken returns the token the client asked progress notifications
+// to be sent with, or nil.
+func progressToken(request mcp.CallToolRequest) mcp.ProgressToken {
+	if request.Params.Meta == nil {
+		return nil
+	}
+	return request.Params.Meta.ProgressToken
+}
+
+// awaitAsyncSearch waits up to wait for an async search to complete,
+// reporting the shards completed so far as MCP progress notifications.
+func (h *ElasticsearchHandler) awaitAsyncSearch(
+	ctx context.Context,
+	log zerolog.Logger,
+	c *cluster,
+	id string,
+	wait time.Duration,
+	token mcp.ProgressToken,
+) error {
+	mcpServer := server.ServerFromContext(ctx)
+	deadline := time.Now().Add(wait)
+
+	for {
+		status, err := c.asyncSearchStatus(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if mcpServer != nil {
+			shards := status.Shards
+			done := shards.Successful + shards.Skipped + shards.Failed
+			params := map[string]any{
+				"progressToken": token,
+				"progress":      done,
+				"message":       fmt.Sprintf("%d of %d shards searched", done, shards.Total),
+			}
+			if shards.Total > 0 {
+				params["total"] = shards.Total
+			}
+			if err := mcpServer.SendNotificationToClient(ctx, "notifications/progress", params); err != nil {
+				log.Debug().Err(err).Msg("Failed to send progress notification")
+			}
+		}
+
+		remaining := time.Until(deadline)
+		if !status.IsRunning || remaining <= 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(min(asyncProgressInterval, remaining)):
+		}
+	}
+}
+
+func (h *ElasticsearchHandler) handleAsyncSearchSubmit(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+
+	index, err := request.RequireString("index")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing index parameter")
+		return mcp.NewToolResultError("Missing 'index' parameter"), nil
+	}
+
+	c, err := h.clusterFor(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, budget, err := h.queryBudget(ctx, "async_search_submit", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
+	wait, err := h.async.waitForCompletion(request.GetString("wait_for_completion_timeout", ""), budget)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	spec := searchSpec{
+		Index:  index,
+		Query:  json.RawMessage(request.GetString("query", "")),
+		Aggs:   json.RawMessage(request.GetString("aggs", "")),
+		Sort:   json.RawMessage(request.GetString("sort", "")),
+		Source: json.RawMessage(request.GetString("_source", "")),
+	}
+	size := request.GetInt("size", 10)
+	spec.Size = &size
+	trackTotalHits := request.GetBool("track_total_hits", true)
+
+	log.Info().Str("index", index).Str("query", string(spec.Query)).Msg("Submitting async search")
+
+	// The search keeps running after the call returns, so only
+	// terminate_after, not the call timeout, bounds it.
+	searchRequest, err := spec.body(queryBudget{TerminateAfter: budget.TerminateAfter})
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	searchRequest["track_total_hits"] = trackTotalHits
+
+	if result := h.checkIndexAccess(ctx, log, c, index); result != nil {
+		return result, nil
+	}
+
+	if violation := h.policy.check(searchRequest); violation != nil {
+		log.Warn().
+			Str("index", index).
+			Str("rule", violation.Rule).
+			Str("path", violation.Path).
+			Msg("Async search rejected by policy")
+		return violation.toolResult(), nil
+	}
+
+	auditRequest(ctx, index, searchRequest)
+
+	body, err := json.Marshal(searchRequest)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal search request")
+		return mcp.NewToolResultError("Failed to create search request"), nil
+	}
+
+	// With progress notifications, the call polls the search's status
+	// instead of waiting for it in a single request.
+	token := progressToken(request)
+	submitWait := wait
+	if token != nil {
+		submitWait = min(wait, asyncProgressInterval)
+	}
+	started := time.Now()
+
+	asyncResponse, err := c.submitAsyncSearch(ctx, index, body, submitWait, h.async.KeepAlive, trackTotalHits)
+	if err != nil {
+		return asyncSearchErrorResult(log, budget, err), nil
+	}
+
+	task := &asyncTask{
+		id:       asyncResponse.ID,
+		tool:     "async_search",
+		clientID: clientIdentityFromContext(ctx).ID,
+		cluster:  c.name,
+		index:    index,
+		body:     searchRequest,
+	}
+	if asyncResponse.IsRunning {
+		if err := h.asyncTasks.put(task); err != nil {
+			log.Warn().Err(err).Msg("Failed to track async search")
+			h.cleanupAsyncSearch(c, task.id)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+
+		if remaining := wait - time.Since(started); token != nil && remaining > 0 {
+			if err := h.awaitAsyncSearch(ctx, log, c, task.id, remaining, token); err != nil {
+				return asyncSearchErrorResult(log, budget, err), nil
+			}
+			if asyncResponse, err = c.getAsyncSearch(ctx, task.id, 0, h.async.KeepAlive); err != nil {
+				return asyncSearchErrorResult(log, budget, err), nil
+			}
+		}
+	}
+
+	return h.asyncSearchResult(ctx, log, c, task, asyncResponse, budget)
+}
+
+func (h *ElasticsearchHandler) handleAsyncSearchGet(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+
+	id, err := request.RequireString("id")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing id parameter")
+		return mcp.NewToolResultError("Missing 'id' parameter"), nil
+	}
+
+	task, err := h.asyncTasks.get(id, "async_search", clientIdentityFromContext(ctx).ID)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	c, ok := h.clusters[task.cluster]
+	if !ok {
+		return mcp.NewToolResultError(errUnknownAsyncTask.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, budget, err := h.queryBudget(ctx, "async_search_get", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
+	wait, err := h.async.waitForCompletion(request.GetString("wait_for_completion_timeout", ""), budget)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	log.Info().Str("index", task.index).Str("id", id).Msg("Polling async search")
+	auditRequest(ctx, task.index, nil)
+
+	if token := progressToken(request); token != nil && wait > 0 {
+		if err := h.awaitAsyncSearch(ctx, log, c, id, wait, token); err != nil {
+			return asyncSearchErrorResult(log, budget, err), nil
+		}
+		wait = 0
+	}
+
+	asyncResponse, err := c.getAsyncSearch(ctx, id, wait, h.async.KeepAlive)
+	if err != nil {
+		return asyncSearchErrorResult(log, budget, err), nil
+	}
+
+	if asyncResponse.IsRunning {
+		// Polling extended the search's keep-alive.
+		if err := h.asyncTasks.put(task); err != nil {
+			log.Warn().Err(err).Msg("Failed to track async search")
+		}
+	}
+
+	return h.asyncSearchResult(ctx, log, c, task, asyncResponse, budget)
+}
+
+func (h *ElasticsearchHandler) handleAsyncSearchDelete(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+
+	id, err := request.RequireString("id")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing id parameter")
+		return mcp.NewToolResultError("Missing 'id' parameter"), nil
+	}
+
+	task, err := h.asyncTasks.get(id, "async_search", clientIdentityFromContext(ctx).ID)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	c, ok := h.clusters[task.cluster]
+	if !ok {
+		return mcp.NewToolResultError(errUnknownAsyncTask.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	log.Info().Str("index", task.index).Str("id", id).Msg("Deleting async search")
+	auditRequest(ctx, task.index, nil)
+
+	if err := c.deleteAsyncSearch(ctx, id); err != nil {
+		log.Error().Err(err).Msg("Failed to delete async search")
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to delete async search: %v", err)), nil
+	}
+	h.asyncTasks.remove(id)
+
+	jsonBytes, err := json.Marshal(map[string]any{
+		"cluster": c.name,
+		"id":      id,
+		"deleted": true,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal delete response")
+		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+	}
+
+	log.Info().Str("id", id).Msg("Async search deleted successfully")
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
+
+// asyncSearchResult renders the state of an async search with its results
+// so far. Searches are deleted once their final results are returned.
+func (h *ElasticsearchHandler) asyncSearchResult(
+	ctx context.Context,
+	log zerolog.Logger,
+	c *cluster,
+	task *asyncTask,
+	asyncResponse *AsyncSearchResponse,
+	budget queryBudget,
+) (*mcp.CallToolResult, error) {
+	searchResponse := asyncResponse.Response
+	if searchResponse == nil {
+		searchResponse = &SearchResponse{}
+	}
+	if errResult := h.redactSearchResponse(ctx, log, c, searchResponse, task.body); errResult != nil {
+		return errResult, nil
+	}
+
+	response := searchResult(c, task.index, searchResponse, budget)
+	response["is_running"] = asyncResponse.IsRunning
+	response["is_partial"] = asyncResponse.IsPartial
+	response["partial"] = asyncResponse.IsPartial || searchResponse.TimedOut || searchResponse.TerminatedEarly
+
+	if asyncResponse.IsRunning {
+		response["id"] = task.id
+		response["expires_at"] = time.UnixMilli(asyncResponse.ExpirationTimeInMillis).UTC()
+		response["message"] = "The search is still running; poll it with async_search_get and this id, or stop it with async_search_delete"
+	} else if task.id != "" {
+		h.asyncTasks.remove(task.id)
+		h.cleanupAsyncSearch(c, task.id)
+	}
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal async search response")
+		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+	}
+
+	log.Info().
+		Str("index", task.index).
+		Bool("is_running", asyncResponse.IsRunning).
+		Int("returned_hits", len(searchResponse.Hits.Hits)).
+		Msg("Async search results returned")
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
+
+// cleanupAsyncSearch deletes an async search that is no longer needed.
+// Failures are only logged: Elasticsearch deletes it once its keep-alive
+// lapses anyway.
+func (h *ElasticsearchHandler) cleanupAsyncSearch(c *cluster, id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := c.deleteAsyncSearch(ctx, id); err != nil {
+		h.logger.Warn().Err(err).Str("cluster", c.name).Msg("Failed to delete async search")
+	}
+}
+
+func asyncSearchErrorResult(log zerolog.Logger, budget queryBudget, err error) *mcp.CallToolResult {
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Warn().Dur("timeout", budget.Timeout).Msg("Async search call exceeded its timeout")
+		return mcp.NewToolResultError(fmt.Sprintf(
+			"Async search call did not return within its %s timeout; lower wait_for_completion_timeout",
+			budget.Timeout,
+		))
+	}
+	log.Error().Err(err).Msg("Failed to execute async search")
+	return mcp.NewToolResultError(fmt.Sprintf("Failed to execute async search: %v", err))
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	auditOutcomeSuccess   = "success"
+	auditOutcomeToolError = "tool_error"
+	auditOutcomeFailure   = "failure"
+
+	auditRedactedValue = "?"
+)
+
+type AuditConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Output is "stderr", "stdout" or the path of a file the audit records
+	// are appended to.
+	Output string `yaml:"output"`
+	// RedactValues replaces the literal values of the RedactArguments
+	// arguments, keeping only their structure.
+	RedactValues    bool     `yaml:"redact_values"`
+	RedactArguments []string `yaml:"redact_arguments,omitempty"`
+}
+
+// AuditRecord is a single line of the audit trail.
+type AuditRecord struct {
+	Time          time.Time      `json:"time"`
+	ClientID      string         `json:"client_id"`
+	AuthMethod    string         `json:"auth_method"`
+	Tool          string         `json:"tool"`
+	Cluster       string         `json:"cluster,omitempty"`
+	Index         string         `json:"index,omitempty"`
+	Arguments     map[string]any `json:"arguments,omitempty"`
+	Request       any            `json:"request,omitempty"`
+	ResponseBytes int            `json:"response_bytes"`
+	Hits          *int           `json:"hits,omitempty"`
+	TotalHits     *int           `json:"total_hits,omitempty"`
+	DurationMS    float64        `json:"duration_ms"`
+	Outcome       string         `json:"outcome"`
+	Error         string         `json:"error,omitempty"`
+}
+
+// auditLogger writes one JSON line per tool invocation to an append-only
+// audit trail, separate from the diagnostic logs.
+type auditLogger struct {
+	cfg            AuditConfig
+	defaultCluster string
+	redacted       map[string]bool
+
+	mu     sync.Mutex
+	out    io.Writer
+	closer io.Closer
+}
+
+func newAuditLogger(cfg AuditConfig, defaultCluster string) (*auditLogger, error) {
+	a := &auditLogger{
+		cfg:            cfg,
+		defaultCluster: defaultCluster,
+		redacted:       make(map[string]bool, len(cfg.RedactArguments)),
+	}
+	for _, arg := range cfg.RedactArguments {
+		a.redacted[arg] = true
+	}
+
+	switch cfg.Output {
+	case "stderr":
+		a.out = os.Stderr
+	case "stdout":
+		a.out = os.Stdout
+	default:
+		f, err := os.OpenFile(cfg.Output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("error opening audit log: %w", err)
+		}
+		a.out, a.closer = f, f
+	}
+
+	return a, nil
+}
+
+func (a *auditLogger) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+// auditDetails is what a tool reports about the request it sent to
+// Elasticsearch, as opposed to the arguments it was called with.
+type auditDetails struct {
+	mu    sync.Mutex
+	index string
+	body  any
+}
+
+type auditDetailsKey struct{}
+
+// auditRequest records the indices a tool call resolved to and the request
+// body it sent to Elasticsearch, for the audit record of the call.
+func auditRequest(ctx context.Context, index string, body any) {
+	details, ok := ctx.Value(auditDetailsKey{}).(*auditDetails)
+	if !ok {
+		return
+	}
+	details.mu.Lock()
+	defer details.mu.Unlock()
+	if index != "" {
+		details.index = index
+	}
+	details.body = body
+}
+
+// middleware records every tool call passing through the MCP server.
+func (a *auditLogger) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		details := &auditDetails{}
+		ctx = context.WithValue(ctx, auditDetailsKey{}, details)
+
+		start := time.Now()
+		result, err := next(ctx, request)
+		a.record(ctx, request, details, result, err, time.Since(start))
+		return result, err
+	}
+}
+
+func (a *auditLogger) record(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+	details *auditDetails,
+	result *mcp.CallToolResult,
+	callErr error,
+	duration time.Duration,
+) {
+	identity := clientIdentityFromContext(ctx)
+
+	record := AuditRecord{
+		Time:       time.Now().UTC(),
+		ClientID:   identity.ID,
+		AuthMethod: identity.Method,
+		Tool:       request.Params.Name,
+		Cluster:    request.GetString("cluster", a.defaultCluster),
+		Index:      request.GetString("index", request.GetString("pattern", "")),
+		Arguments:  a.arguments(request.GetArguments()),
+		DurationMS: float64(duration.Microseconds()) / 1000,
+		Outcome:    auditOutcomeSuccess,
+	}
+
+	details.mu.Lock()
+	if details.index != "" {
+		record.Index = details.index
+	}
+	record.Request = details.body
+	details.mu.Unlock()
+	if a.cfg.RedactValues && record.Request != nil {
+		record.Request = redactValues(toJSONValue(record.Request))
+	}
+
+	switch {
+	case callErr != nil:
+		record.Outcome = auditOutcomeFailure
+		record.Error = callErr.Error()
+	case result != nil:
+		text := resultText(result)
+		record.ResponseBytes = len(text)
+		if result.IsError {
+			record.Outcome = auditOutcomeToolError
+			record.Error = text
+		} else {
+			record.Hits, record.TotalHits = hitCounts(text)
+		}
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, _ = a.out.Write(line)
+}
+
+// arguments returns a copy of the tool call arguments with the values of the
+// redacted arguments replaced. JSON arguments such as a query DSL keep their
+// structure, so the audit trail still shows which fields and query types were
+// used; other strings are replaced entirely.
+func (a *auditLogger) arguments(args map[string]any) map[string]any {
+	if !a.cfg.RedactValues || len(args) == 0 {
+		return args
+	}
+
+	out := make(map[string]any, len(args))
+	for name, value := range args {
+		if !a.redacted[name] {
+			out[name] = value
+			continue
+		}
+
+		if s, ok := value.(string); ok {
+			var parsed any
+			if err := json.Unmarshal([]byte(s), &parsed); err == nil {
+				value = parsed
+			}
+		}
+		out[name] = redactValues(value)
+	}
+	return out
+}
+
+// toJSONValue converts a request body to its generic JSON form, so that
+// redactValues can walk it.
+func toJSONValue(value any) any {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var parsed any
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil
+	}
+	return parsed
+}
+
+// redactValues replaces every scalar in value, keeping object keys.
+func redactValues(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, child := range v {
+			out[key] = redactValues(child)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, child := range v {
+			out[i] = redactValues(child)
+		}
+		return out
+	case nil:
+		return nil
+	default:
+		return auditRedactedValue
+	}
+}
+
+func resultText(result *mcp.CallToolResult) string {
+	var text string
+	for _, content := range result.Content {
+		if tc, ok := content.(mcp.TextContent); ok {
+			text += tc.Text
+		}
+	}
+	return text
+}
+
+// hitCounts extracts the number of returned and total hits from a search
+// style tool result, when present.
+func hitCounts(text string) (hits, total *int) {
+	var parsed struct {
+		Hits      []json.RawMessage `json:"hits"`
+		TotalHits *int              `json:"total_hits"`
+	}
+	if err := json.Unmarshal([]byte(text), &parsed); err != nil {
+		return nil, nil
+	}
+	if parsed.Hits != nil {
+		n := len(parsed.Hits)
+		hits = &n
+	}
+	return hits, parsed.TotalHits
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestAuditMiddlewareRecordsRequest(t *testing.T) {
+	tests := []struct {
+		name         string
+		redactValues bool
+		wantRequest  string
+	}{
+		{"plain", false, `{"query":{"term":{"user.id":"alice"}},"size":10}`},
+		{"redacted values", true, `{"query":{"term":{"user.id":"?"}},"size":"?"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			a := &auditLogger{
+				cfg:      AuditConfig{RedactValues: tt.redactValues},
+				redacted: map[string]bool{},
+				out:      &out,
+			}
+
+			handler := a.middleware(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				auditRequest(ctx, "logs-app,logs-web", map[string]any{
+					"query": map[string]any{"term": map[string]any{"user.id": "alice"}},
+					"size":  10,
+				})
+				return mcp.NewToolResultText(`{"hits":[]}`), nil
+			})
+
+			request := mcp.CallToolRequest{}
+			request.Params.Name = "esql"
+			request.Params.Arguments = map[string]any{"query": "FROM logs-app,logs-web"}
+			if _, err := handler(context.Background(), request); err != nil {
+				t.Fatalf("handler error = %v", err)
+			}
+
+			var record struct {
+				Index   string          `json:"index"`
+				Request json.RawMessage `json:"request"`
+			}
+			if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+				t.Fatalf("invalid audit record %q: %v", out.String(), err)
+			}
+			if record.Index != "logs-app,logs-web" {
+				t.Errorf("index = %q, want the resolved indices", record.Index)
+			}
+			if string(record.Request) != tt.wantRequest {
+				t.Errorf("request = %s, want %s", record.Request, tt.wantRequest)
+			}
+		})
+	}
+}
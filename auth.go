@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
+)
+
+const (
+	authModeNone   = "none"
+	authModeStatic = "static"
+	authModeHMAC   = "hmac"
+	authModeJWT    = "jwt"
+)
+
+var (
+	errMissingToken = errors.New("missing bearer token")
+	errInvalidToken = errors.New("invalid bearer token")
+)
+
+// ClientIdentity identifies the caller of an MCP request.
+type ClientIdentity struct {
+	ID     string
+	Method string
+}
+
+var anonymousIdentity = ClientIdentity{ID: "anonymous", Method: authModeNone}
+
+type clientIdentityKey struct{}
+
+func withClientIdentity(ctx context.Context, identity ClientIdentity) context.Context {
+	return context.WithValue(ctx, clientIdentityKey{}, identity)
+}
+
+// clientIdentityFromContext returns the identity attached by the HTTP
+// authentication middleware, or the anonymous identity when there is none
+// (stdio transport or authentication disabled).
+func clientIdentityFromContext(ctx context.Context) ClientIdentity {
+	if identity, ok := ctx.Value(clientIdentityKey{}).(ClientIdentity); ok {
+		return identity
+	}
+	return anonymousIdentity
+}
+
+// Authenticator validates the credentials of an incoming MCP HTTP request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (ClientIdentity, error)
+}
+
+func newAuthenticator(cfg AuthConfig) (Authenticator, error) {
+	switch cfg.Mode {
+	case authModeNone:
+		return nil, nil
+	case authModeStatic:
+		return newStaticTokenAuthenticator(cfg.Tokens)
+	case authModeHMAC:
+		return newHMACAuthenticator(cfg.HMACSecret)
+	case authModeJWT:
+		return newJWTAuthenticator(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported auth mode: %s", cfg.Mode)
+	}
+}
+
+// authMiddleware rejects requests that fail authentication and tags the
+// request context of accepted requests with the caller's identity.
+func authMiddleware(auth Authenticator, next http.Handler, logger zerolog.Logger) http.Handler {
+	if auth == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := auth.Authenticate(r)
+		if err != nil {
+			logger.Warn().
+				Err(err).
+				Str("remote_addr", r.RemoteAddr).
+				Str("path", r.URL.Path).
+				Msg("Rejected unauthenticated request")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mcp-elasticsearch"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		logger.Debug().
+			Str("client_id", identity.ID).
+			Str("auth_method", identity.Method).
+			Str("path", r.URL.Path).
+			Msg("Authenticated request")
+
+		next.ServeHTTP(w, r.WithContext(withClientIdentity(r.Context(), identity)))
+	})
+}
+
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", errMissingToken
+	}
+	return strings.TrimSpace(token), nil
+}
+
+// staticTokenAuthenticator accepts a fixed list of tokens, each one bound to
+// a client name.
+type staticTokenAuthenticator struct {
+	tokens map[string]string
+}
+
+// newStaticTokenAuthenticator parses a list of "client:token" pairs.
+func newStaticTokenAuthenticator(entries []string) (*staticTokenAuthenticator, error) {
+	tokens := make(map[string]string)
+	for _, entry := range entries {
+		client, token, ok := strings.Cut(entry, ":")
+		if !ok || client == "" || token == "" {
+			return nil, fmt.Errorf("invalid static token entry %q, expected client:token", entry)
+		}
+		if _, exists := tokens[token]; exists {
+			return nil, fmt.Errorf("duplicate static token for client %q", client)
+		}
+		tokens[token] = client
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("static auth requires at least one client:token pair")
+	}
+	return &staticTokenAuthenticator{tokens: tokens}, nil
+}
+
+func (a *staticTokenAuthenticator) Authenticate(r *http.Request) (ClientIdentity, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return ClientIdentity{}, err
+	}
+
+	// Compare against every token to avoid leaking which prefix matched.
+	var client string
+	for candidate, name := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			client = name
+		}
+	}
+	if client == "" {
+		return ClientIdentity{}, errInvalidToken
+	}
+	return ClientIdentity{ID: client, Method: authModeStatic}, nil
+}
+
+// hmacAuthenticator accepts tokens of the form
+// base64url(claims).base64url(HMAC-SHA256(secret, base64url(claims))), where
+// claims is a JSON object with a "sub" client name and an optional "exp" unix
+// timestamp.
+type hmacAuthenticator struct {
+	secret []byte
+	now    func() time.Time
+}
+
+type hmacClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+func newHMACAuthenticator(secret string) (*hmacAuthenticator, error) {
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("HMAC auth secret must be at least 32 bytes long")
+	}
+	return &hmacAuthenticator{secret: []byte(secret), now: time.Now}, nil
+}
+
+func (a *hmacAuthenticator) Authenticate(r *http.Request) (ClientIdentity, error) {
+	token, err := bearerToken(r)
+	if err != nil {
+		return ClientIdentity{}, err
+	}
+
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ClientIdentity{}, errInvalidToken
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return ClientIdentity{}, errInvalidToken
+	}
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(payload))
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ClientIdentity{}, errInvalidToken
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return ClientIdentity{}, errInvalidToken
+	}
+	var claims hmacClaims
+	if err := json.Unmarshal(raw, &claims); err != nil || claims.Subject == "" {
+		return ClientIdentity{}, errInvalidToken
+	}
+	if claims.ExpiresAt != 0 && a.now().Unix() >= claims.ExpiresAt {
+		return ClientIdentity{}, fmt.Errorf("token expired")
+	}
+
+	return ClientIdentity{ID: claims.Subject, Method: authModeHMAC}, nil
+}
+
+// jwtAuthenticator verifies JWTs against the keys of a local JWKS file.
+type jwtAuthenticator struct {
+	keys        map[string]any
+	parser      *jwt.Parser
+	clientClaim string
+}
+
+func newJWTAuthenticator(cfg AuthConfig) (*jwtAuthenticator, error) {
+	keys, err := loadJWKS(cfg.JWKSFile)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{
+			"RS256", "RS384", "RS512",
+			"PS256", "PS384", "PS512",
+			"ES256", "ES384", "ES512",
+			"HS256", "HS384", "HS512",
+		}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if cfg.JWTIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.JWTIssuer))
+	}
+	if cfg.JWTAudience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.JWTAudience))
+	}
+
+	return &jwtAuthenticator{
+		keys:        keys,
+		parser:      jwt.NewParser(opts...),
+		clientClaim: cfg.JWTClientClaim,
+	}, nil
+}
+
+func (a *jwtAuthenticator) Authenticate(r *http.Request) (ClientIdentity, error) {
+	raw, err := bearerToken(r)
+	if err != nil {
+		return ClientIdentity{}, err
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := a.parser.ParseWithClaims(raw, claims, a.keyFunc); err != nil {
+		return ClientIdentity{}, fmt.Errorf("%w: %v", errInvalidToken, err)
+	}
+
+	client, _ := claims[a.clientClaim].(string)
+	if client == "" {
+		return ClientIdentity{}, fmt.Errorf("%w: missing %q claim", errInvalidToken, a.clientClaim)
+	}
+	return ClientIdentity{ID: client, Method: authModeJWT}, nil
+}
+
+func (a *jwtAuthenticator) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" && len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key, nil
+		}
+	}
+	key, ok := a.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// loadJWKS reads a JSON Web Key Set and returns its signing keys by key id.
+func loadJWKS(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading JWKS file: %w", err)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("error parsing JWKS file %s: %w", path, err)
+	}
+
+	keys := make(map[string]any)
+	for i, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %d in JWKS file %s: %w", i, path, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS file %s contains no signing keys", path)
+	}
+
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return nil, fmt.Errorf("invalid symmetric key: %w", err)
+		}
+		return secret, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
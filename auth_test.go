@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// authRequest returns an MCP request carrying the given Authorization
+// header, if any.
+func authRequest(header string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	if header != "" {
+		r.Header.Set("Authorization", header)
+	}
+	return r
+}
+
+func TestStaticTokenAuthenticator(t *testing.T) {
+	auth, err := newStaticTokenAuthenticator([]string{"alice:token-a", "ci:token-ci"})
+	if err != nil {
+		t.Fatalf("newStaticTokenAuthenticator() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		header  string
+		want    string
+		wantErr error
+	}{
+		{name: "valid token", header: "Bearer token-a", want: "alice"},
+		{name: "scheme is case insensitive", header: "bearer token-ci", want: "ci"},
+		{name: "missing header", wantErr: errMissingToken},
+		{name: "other scheme", header: "Basic token-a", wantErr: errMissingToken},
+		{name: "empty token", header: "Bearer  ", wantErr: errMissingToken},
+		{name: "unknown token", header: "Bearer token-b", wantErr: errInvalidToken},
+		{name: "token prefix", header: "Bearer token", wantErr: errInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := auth.Authenticate(authRequest(tt.header))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if identity.ID != tt.want || identity.Method != authModeStatic {
+				t.Errorf("Authenticate() = %+v, want client %q", identity, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewStaticTokenAuthenticatorErrors(t *testing.T) {
+	for _, entries := range [][]string{nil, {"alice"}, {"alice:"}, {":token"}, {"alice:token", "bob:token"}} {
+		if _, err := newStaticTokenAuthenticator(entries); err == nil {
+			t.Errorf("newStaticTokenAuthenticator(%q) succeeded, want an error", entries)
+		}
+	}
+}
+
+func TestHMACAuthenticator(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	now := time.Unix(1_700_000_000, 0)
+
+	auth, err := newHMACAuthenticator(secret)
+	if err != nil {
+		t.Fatalf("newHMACAuthenticator() error = %v", err)
+	}
+	auth.now = func() time.Time { return now }
+
+	sign := func(secret string, claims hmacClaims) string {
+		raw, _ := json.Marshal(claims)
+		payload := base64.RawURLEncoding.EncodeToString(raw)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(payload))
+		return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{name: "valid", token: sign(secret, hmacClaims{Subject: "alice"}), want: "alice"},
+		{name: "not expired", token: sign(secret, hmacClaims{Subject: "alice", ExpiresAt: now.Unix() + 60}), want: "alice"},
+		{name: "expired", token: sign(secret, hmacClaims{Subject: "alice", ExpiresAt: now.Unix()}), wantErr: true},
+		{name: "other secret", token: sign("fedcba9876543210fedcba9876543210", hmacClaims{Subject: "alice"}), wantErr: true},
+		{name: "no subject", token: sign(secret, hmacClaims{}), wantErr: true},
+		{name: "no signature", token: "eyJzdWIiOiJhbGljZSJ9", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := auth.Authenticate(authRequest("Bearer " + tt.token))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Authenticate() = %+v, want an error", identity)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if identity.ID != tt.want || identity.Method != authModeHMAC {
+				t.Errorf("Authenticate() = %+v, want client %q", identity, tt.want)
+			}
+		})
+	}
+
+	if _, err := newHMACAuthenticator("too-short"); err == nil {
+		t.Error("newHMACAuthenticator() accepted a short secret")
+	}
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	key := []byte("jwt-test-key-with-enough-entropy!")
+	jwks := map[string]any{"keys": []map[string]any{{
+		"kty": "oct",
+		"kid": "test",
+		"k":   base64.RawURLEncoding.EncodeToString(key),
+	}}}
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := newJWTAuthenticator(AuthConfig{
+		JWKSFile:       path,
+		JWTIssuer:      "https://idp.example.com",
+		JWTAudience:    "mcp-elasticsearch",
+		JWTClientClaim: "sub",
+	})
+	if err != nil {
+		t.Fatalf("newJWTAuthenticator() error = %v", err)
+	}
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub": "alice",
+			"iss": "https://idp.example.com",
+			"aud": "mcp-elasticsearch",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+	}
+	sign := func(method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return signed
+	}
+	with := func(name string, value any) jwt.MapClaims {
+		claims := valid()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "valid", token: sign(jwt.SigningMethodHS256, "test", key, valid())},
+		{name: "single key without kid", token: sign(jwt.SigningMethodHS256, "", key, valid())},
+		{name: "unknown kid", token: sign(jwt.SigningMethodHS256, "other", key, valid()), wantErr: true},
+		{name: "wrong key", token: sign(jwt.SigningMethodHS256, "test", []byte("another-key-another-key-another!!"), valid()), wantErr: true},
+		{name: "expired", token: sign(jwt.SigningMethodHS256, "test", key, with("exp", time.Now().Add(-time.Hour).Unix())), wantErr: true},
+		{name: "no expiry", token: sign(jwt.SigningMethodHS256, "test", key, with("exp", nil)), wantErr: true},
+		{name: "wrong issuer", token: sign(jwt.SigningMethodHS256, "test", key, with("iss", "https://evil.example.com")), wantErr: true},
+		{name: "wrong audience", token: sign(jwt.SigningMethodHS256, "test", key, with("aud", "other")), wantErr: true},
+		{name: "no client claim", token: sign(jwt.SigningMethodHS256, "test", key, with("sub", nil)), wantErr: true},
+		{name: "unsigned", token: sign(jwt.SigningMethodNone, "test", jwt.UnsafeAllowNoneSignatureType, valid()), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := auth.Authenticate(authRequest("Bearer " + tt.token))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Authenticate() = %+v, want an error", identity)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+			if identity.ID != "alice" || identity.Method != authModeJWT {
+				t.Errorf("Authenticate() = %+v, want client alice", identity)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// deadlineGrace is added to the Elasticsearch timeout to form the client
+// side deadline, leaving Elasticsearch time to return partial results before
+// the request is abandoned.
+const deadlineGrace = 5 * time.Second
+
+// QueryBudgetConfig bounds the time and work a tool call may spend in
+// Elasticsearch. The top-level settings apply to every tool; Tools overrides
+// them for individual tools.
+type QueryBudgetConfig struct {
+	BudgetConfig `yaml:",inline"`
+	Tools        map[string]BudgetConfig `yaml:"tools,omitempty"`
+}
+
+// BudgetConfig holds the default and maximum timeout and terminate_after of
+// a tool call. Callers may ask for a different timeout or terminate_after,
+// up to the maximum. Zero values leave the setting unbounded.
+type BudgetConfig struct {
+	Timeout           time.Duration `yaml:"timeout,omitempty"`
+	MaxTimeout        time.Duration `yaml:"max_timeout,omitempty"`
+	TerminateAfter    int           `yaml:"terminate_after,omitempty"`
+	MaxTerminateAfter int           `yaml:"max_terminate_after,omitempty"`
+}
+
+// forTool returns the budget settings of a tool, falling back to the
+// top-level settings for those the tool does not override.
+func (cfg QueryBudgetConfig) forTool(tool string) BudgetConfig {
+	budget := cfg.BudgetConfig
+	override, ok := cfg.Tools[tool]
+	if !ok {
+		return budget
+	}
+
+	if override.Timeout > 0 {
+		budget.Timeout = override.Timeout
+	}
+	if override.MaxTimeout > 0 {
+		budget.MaxTimeout = override.MaxTimeout
+	}
+	if override.TerminateAfter > 0 {
+		budget.TerminateAfter = override.TerminateAfter
+	}
+	if override.MaxTerminateAfter > 0 {
+		budget.MaxTerminateAfter = override.MaxTerminateAfter
+	}
+	return budget
+}
+
+// queryBudget is the effective budget of a single tool call.
+type queryBudget struct {
+	Timeout        time.Duration
+	TerminateAfter int
+}
+
+// resolve combines the settings with the timeout and terminate_after the
+// caller asked for, clamping them to the maximums.
+func (cfg BudgetConfig) resolve(timeout string, terminateAfter int) (queryBudget, error) {
+	budget := queryBudget{Timeout: cfg.Timeout, TerminateAfter: cfg.TerminateAfter}
+
+	if timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return queryBudget{}, fmt.Errorf("invalid timeout %q, expected a positive duration such as 30s", timeout)
+		}
+		budget.Timeout = d
+	}
+	if cfg.MaxTimeout > 0 && (budget.Timeout <= 0 || budget.Timeout > cfg.MaxTimeout) {
+		budget.Timeout = cfg.MaxTimeout
+	}
+
+	if terminateAfter < 0 {
+		return queryBudget{}, fmt.Errorf("terminate_after must be >= 0")
+	}
+	if terminateAfter > 0 {
+		budget.TerminateAfter = terminateAfter
+	}
+	if cfg.MaxTerminateAfter > 0 &&
+		(budget.TerminateAfter <= 0 || budget.TerminateAfter > cfg.MaxTerminateAfter) {
+		budget.TerminateAfter = cfg.MaxTerminateAfter
+	}
+
+	return budget, nil
+}
+
+// context bounds ctx by the budget timeout plus a grace period.
+func (b queryBudget) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if b.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, b.Timeout+deadlineGrace)
+}
+
+// queryBudget resolves the budget of a tool call from the configuration and
+// the call's optional "timeout" and "terminate_after" arguments, and returns
+// the call context bounded by it.
+func (h *ElasticsearchHandler) queryBudget(
+	ctx context.Context,
+	tool string,
+	request mcp.CallToolRequest,
+) (context.Context, context.CancelFunc, queryBudget, error) {
+	budget, err := h.budgets.forTool(tool).resolve(
+		request.GetString("timeout", ""),
+		request.GetInt("terminate_after", 0),
+	)
+	if err != nil {
+		return nil, nil, queryBudget{}, err
+	}
+
+	ctx, cancel := budget.context(ctx)
+	return ctx, cancel, budget, nil
+}
+
+// response describes the budget a call ran with, for tool responses.
+func (b queryBudget) response() map[string]any {
+	response := map[string]any{}
+	if b.Timeout > 0 {
+		response["timeout"] = b.Timeout.String()
+	}
+	if b.TerminateAfter > 0 {
+		response["terminate_after"] = b.TerminateAfter
+	}
+	return response
+}
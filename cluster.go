@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/rs/zerolog"
+)
+
+const defaultClusterName = "default"
+
+// Elasticsearch authentication methods.
+const (
+	esAuthAPIKey       = "api_key"
+	esAuthBasic        = "basic"
+	esAuthServiceToken = "service_token"
+	esAuthBearer       = "bearer"
+	esAuthNone         = "none"
+)
+
+// authMethod returns the explicitly configured authentication method or,
+// when none is set, infers it from the credentials that are present.
+func (cfg ElasticsearchConfig) authMethod() string {
+	switch {
+	case cfg.Auth != "":
+		return cfg.Auth
+	case cfg.APIKey != "":
+		return esAuthAPIKey
+	case cfg.ServiceToken != "":
+		return esAuthServiceToken
+	case cfg.BearerToken != "":
+		return esAuthBearer
+	case cfg.Username != "" && cfg.Password != "":
+		return esAuthBasic
+	default:
+		return ""
+	}
+}
+
+// endpoint describes where the cluster lives for logs and list_clusters.
+func (cfg ElasticsearchConfig) endpoint() string {
+	if cfg.CloudID != "" {
+		name, _, _ := strings.Cut(cfg.CloudID, ":")
+		return "cloud:" + name
+	}
+	return cfg.URL
+}
+
+// cluster is a named Elasticsearch cluster the server can query.
+type cluster struct {
+	name     string
+	endpoint string
+	client   *elasticsearch.Client
+}
+
+// ClusterInfo is the subset of the Elasticsearch root endpoint response
+// reported by list_clusters.
+type ClusterInfo struct {
+	Name        string `json:"name"`
+	ClusterName string `json:"cluster_name"`
+	ClusterUUID string `json:"cluster_uuid"`
+	Version     struct {
+		Number string `json:"number"`
+	} `json:"version"`
+}
+
+func newCluster(cfg ElasticsearchConfig, logger zerolog.Logger) (*cluster, error) {
+	log := logger.With().Str("cluster", cfg.Name).Logger()
+
+	log.Info().Str("endpoint", cfg.endpoint()).Msg("Creating Elasticsearch client")
+
+	// Configure Elasticsearch client
+	var esCfg elasticsearch.Config
+	if cfg.CloudID != "" {
+		esCfg.CloudID = cfg.CloudID
+	} else {
+		esCfg.Addresses = []string{cfg.URL}
+	}
+
+	// Set authentication method
+	switch cfg.authMethod() {
+	case esAuthAPIKey:
+		esCfg.APIKey = cfg.APIKey
+		log.Info().Msg("Using API key authentication")
+	case esAuthBasic:
+		esCfg.Username = cfg.Username
+		esCfg.Password = cfg.Password
+		log.Info().Str("username", cfg.Username).Msg("Using basic authentication")
+	case esAuthServiceToken:
+		esCfg.ServiceToken = cfg.ServiceToken
+		log.Info().Msg("Using service token authentication")
+	case esAuthBearer:
+		esCfg.Header = http.Header{"Authorization": []string{"Bearer " + cfg.BearerToken}}
+		log.Info().Msg("Using bearer token authentication")
+	case esAuthNone:
+		log.Warn().Msg("Elasticsearch authentication is disabled")
+	}
+
+	// Set TLS options
+	if cfg.hasTLSSettings() {
+		transport, err := newHTTPTransport(cfg)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to configure TLS")
+			return nil, fmt.Errorf("error configuring TLS: %w", err)
+		}
+		esCfg.Transport = transport
+
+		log.Info().
+			Bool("custom_ca", cfg.CACertFile != "").
+			Bool("pinned_fingerprint", cfg.CAFingerprint != "").
+			Bool("client_certificate", cfg.ClientCertFile != "").
+			Msg("Using custom TLS configuration")
+		if cfg.InsecureSkipVerify {
+			log.Warn().Msg("TLS certificate verification is disabled")
+		}
+	}
+
+	client, err := elasticsearch.NewClient(esCfg)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create Elasticsearch client")
+		return nil, fmt.Errorf("error creating elasticsearch client: %w", err)
+	}
+
+	return &cluster{
+		name:     cfg.Name,
+		endpoint: cfg.endpoint(),
+		client:   client,
+	}, nil
+}
+
+// info fetches the root endpoint of the cluster.
+func (c *cluster) info(ctx context.Context) (*ClusterInfo, error) {
+	res, err := c.client.Info(c.client.Info.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to elasticsearch: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch connection error: %s", res.String())
+	}
+
+	var info ClusterInfo
+	if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("error decoding cluster info: %w", err)
+	}
+	return &info, nil
+}
+
+func (c *cluster) ping(ctx context.Context) error {
+	_, err := c.info(ctx)
+	return err
+}
+
+// clusterFor resolves the optional "cluster" tool argument, falling back to
+// the default cluster.
+func (h *ElasticsearchHandler) clusterFor(request mcp.CallToolRequest) (*cluster, error) {
+	name := request.GetString("cluster", "")
+	if name == "" {
+		name = h.defaultCluster
+	}
+
+	c, ok := h.clusters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown cluster %q, available clusters: %v", name, h.clusterNames)
+	}
+	return c, nil
+}
+
+func (h *ElasticsearchHandler) handleListClusters(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+
+	log.Info().Msg("Listing clusters")
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result := make([]map[string]any, len(h.clusterNames))
+
+	var wg sync.WaitGroup
+	for i, name := range h.clusterNames {
+		wg.Add(1)
+		go func(i int, c *cluster) {
+			defer wg.Done()
+
+			entry := map[string]any{
+				"name":      c.name,
+				"endpoint":  c.endpoint,
+				"default":   c.name == h.defaultCluster,
+				"reachable": false,
+			}
+
+			info, err := c.info(ctx)
+			if err != nil {
+				log.Warn().Err(err).Str("cluster", c.name).Msg("Cluster is not reachable")
+				entry["error"] = err.Error()
+			} else {
+				entry["reachable"] = true
+				entry["version"] = info.Version.Number
+				entry["cluster_name"] = info.ClusterName
+				entry["cluster_uuid"] = info.ClusterUUID
+			}
+
+			result[i] = entry
+		}(i, h.clusters[name])
+	}
+	wg.Wait()
+
+	response := map[string]any{
+		"default_cluster": h.defaultCluster,
+		"total_clusters":  len(result),
+		"clusters":        result,
+	}
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal clusters response")
+		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+	}
+
+	log.Info().Int("count", len(result)).Msg("Listed clusters successfully")
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
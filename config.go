@@ -3,85 +3,731 @@ package main
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Elasticsearch ElasticsearchConfig
-	Server        ServerConfig
-	Logging       LoggingConfig
+	Clusters       []ElasticsearchConfig `yaml:"clusters"`
+	DefaultCluster string                `yaml:"default_cluster"`
+	Server         ServerConfig          `yaml:"server"`
+	Auth           AuthConfig            `yaml:"auth"`
+	IndexAccess    IndexAccessConfig     `yaml:"index_access"`
+	SearchPolicy   SearchPolicyConfig    `yaml:"search_policy"`
+	Redaction      RedactionConfig       `yaml:"redaction"`
+	Audit          AuditConfig           `yaml:"audit"`
+	RateLimit      RateLimitConfig       `yaml:"rate_limit"`
+	QueryBudget    QueryBudgetConfig     `yaml:"query_budget"`
+	Pagination     PaginationConfig      `yaml:"pagination"`
+	ESQL           ESQLConfig            `yaml:"esql"`
+	SQL            SQLConfig             `yaml:"sql"`
+	Async          AsyncConfig           `yaml:"async"`
+	Semantic       SemanticConfig        `yaml:"semantic"`
+	Logging        LoggingConfig         `yaml:"logging"`
 }
 
 type ElasticsearchConfig struct {
-	URL      string
-	APIKey   string
-	Username string
-	Password string
+	Name         string `yaml:"name"`
+	URL          string `yaml:"url,omitempty"`
+	CloudID      string `yaml:"cloud_id,omitempty"`
+	Auth         string `yaml:"auth,omitempty"`
+	APIKey       string `yaml:"api_key,omitempty"`
+	Username     string `yaml:"username,omitempty"`
+	Password     string `yaml:"password,omitempty"`
+	ServiceToken string `yaml:"service_token,omitempty"`
+	BearerToken  string `yaml:"bearer_token,omitempty"`
+
+	CACertFile         string `yaml:"ca_cert,omitempty"`
+	CAFingerprint      string `yaml:"ca_fingerprint,omitempty"`
+	ClientCertFile     string `yaml:"client_cert,omitempty"`
+	ClientKeyFile      string `yaml:"client_key,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
 }
 
 type ServerConfig struct {
-	Name    string
-	Version string
+	Name            string        `yaml:"name"`
+	Version         string        `yaml:"-"`
+	Transport       string        `yaml:"transport"`
+	ListenAddr      string        `yaml:"listen_addr"`
+	BasePath        string        `yaml:"base_path"`
+	PublicURL       string        `yaml:"public_url,omitempty"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type AuthConfig struct {
+	Mode           string   `yaml:"mode"`
+	Tokens         []string `yaml:"tokens,omitempty"`
+	HMACSecret     string   `yaml:"hmac_secret,omitempty"`
+	JWKSFile       string   `yaml:"jwks_file,omitempty"`
+	JWTIssuer      string   `yaml:"jwt_issuer,omitempty"`
+	JWTAudience    string   `yaml:"jwt_audience,omitempty"`
+	JWTClientClaim string   `yaml:"jwt_client_claim,omitempty"`
 }
 
 type LoggingConfig struct {
-	Level  string
-	Format string
-	Output string
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+	Output string `yaml:"output"`
 }
 
-func loadConfig() (*Config, error) {
+// loadConfig assembles the configuration from, in increasing order of
+// precedence, built-in defaults, the optional configuration file, the
+// environment and command line flags.
+func loadConfig(flags *Flags) (*Config, error) {
 	// Load .env file if it exists (ignore error if file doesn't exist)
 	_ = godotenv.Overload()
 
-	config := &Config{
-		Elasticsearch: ElasticsearchConfig{
-			URL:      getEnv("ES_URL", "http://localhost:9200"),
-			APIKey:   getEnv("ES_API_KEY", ""),
-			Username: getEnv("ES_USERNAME", ""),
-			Password: getEnv("ES_PASSWORD", ""),
-		},
+	config := defaultConfig()
+
+	configFile := flags.ConfigFile
+	if configFile == "" {
+		configFile = getEnv("MCP_ES_CONFIG", "")
+	}
+	if configFile != "" {
+		if err := loadConfigFile(configFile, config); err != nil {
+			return nil, fmt.Errorf("invalid configuration: %w", err)
+		}
+	}
+
+	if err := applyEnv(config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	if err := flags.apply(config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	config.Server.BasePath = "/" + strings.Trim(config.Server.BasePath, "/")
+
+	if err := validateConfig(config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+func defaultConfig() *Config {
+	return &Config{
 		Server: ServerConfig{
-			Name:    getEnv("MCP_ES_SERVER_NAME", "mcp-elasticsearch 🔍"),
-			Version: version,
+			Name:            "mcp-elasticsearch 🔍",
+			Version:         version,
+			Transport:       transportStdio,
+			ListenAddr:      ":8080",
+			BasePath:        "/mcp",
+			ShutdownTimeout: 10 * time.Second,
+		},
+		Auth: AuthConfig{
+			Mode:           authModeNone,
+			JWTClientClaim: "sub",
+		},
+		SearchPolicy: SearchPolicyConfig{
+			Enabled:               true,
+			AllowRuntimeMappings:  true,
+			AllowLeadingWildcards: true,
+		},
+		QueryBudget: QueryBudgetConfig{
+			BudgetConfig: BudgetConfig{
+				Timeout:    30 * time.Second,
+				MaxTimeout: 2 * time.Minute,
+			},
+		},
+		Pagination: PaginationConfig{
+			KeepAlive:  time.Minute,
+			MaxCursors: 100,
+		},
+		ESQL: ESQLConfig{
+			MaxRows: 1000,
+		},
+		SQL: SQLConfig{
+			MaxFetchSize: 1000,
+		},
+		Async: AsyncConfig{
+			WaitForCompletion: 10 * time.Second,
+			KeepAlive:         5 * time.Minute,
+			MaxRunning:        20,
+		},
+		Audit: AuditConfig{
+			Output:          "stderr",
+			RedactArguments: []string{"query"},
 		},
 		Logging: LoggingConfig{
-			Level:  getEnv("MCP_ES_LOG_LEVEL", "info"),
-			Format: getEnv("MCP_ES_LOG_FORMAT", "console"),
-			Output: getEnv("MCP_ES_LOG_OUTPUT", "stderr"),
+			Level:  "info",
+			Format: "console",
+			Output: "stderr",
 		},
 	}
+}
 
-	if err := validateConfig(config); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
+// applyEnv overrides the configuration with the environment variables that
+// are set.
+func applyEnv(config *Config) error {
+	config.Server.Name = getEnv("MCP_ES_SERVER_NAME", config.Server.Name)
+	config.Server.Transport = getEnv("MCP_ES_TRANSPORT", config.Server.Transport)
+	config.Server.ListenAddr = getEnv("MCP_ES_LISTEN_ADDR", config.Server.ListenAddr)
+	config.Server.BasePath = getEnv("MCP_ES_BASE_PATH", config.Server.BasePath)
+	config.Server.PublicURL = getEnv("MCP_ES_PUBLIC_URL", config.Server.PublicURL)
+	if err := loadEnv(
+		envField{"MCP_ES_SHUTDOWN_TIMEOUT", &config.Server.ShutdownTimeout},
+	); err != nil {
+		return err
 	}
 
-	return config, nil
+	config.Auth.Mode = getEnv("MCP_ES_AUTH_MODE", config.Auth.Mode)
+	config.Auth.JWKSFile = getEnv("MCP_ES_AUTH_JWKS_FILE", config.Auth.JWKSFile)
+	config.Auth.JWTIssuer = getEnv("MCP_ES_AUTH_JWT_ISSUER", config.Auth.JWTIssuer)
+	config.Auth.JWTAudience = getEnv("MCP_ES_AUTH_JWT_AUDIENCE", config.Auth.JWTAudience)
+	config.Auth.JWTClientClaim = getEnv("MCP_ES_AUTH_JWT_CLIENT_CLAIM", config.Auth.JWTClientClaim)
+
+	var tokens string
+	if err := loadSecrets(
+		secretField{"MCP_ES_AUTH_TOKENS", &tokens},
+		secretField{"MCP_ES_AUTH_HMAC_SECRET", &config.Auth.HMACSecret},
+	); err != nil {
+		return err
+	}
+	if tokens != "" {
+		config.Auth.Tokens = splitList(tokens)
+	}
+
+	if allowed := getEnv("MCP_ES_ALLOWED_INDICES", ""); allowed != "" {
+		config.IndexAccess.Allow = splitList(allowed)
+	}
+	if denied := getEnv("MCP_ES_DENIED_INDICES", ""); denied != "" {
+		config.IndexAccess.Deny = splitList(denied)
+	}
+
+	policy := &config.SearchPolicy
+	if err := loadEnv(
+		envField{"MCP_ES_POLICY_ENABLED", &policy.Enabled},
+		envField{"MCP_ES_POLICY_ALLOW_SCRIPTS", &policy.AllowScripts},
+		envField{"MCP_ES_POLICY_ALLOW_RUNTIME_MAPPINGS", &policy.AllowRuntimeMappings},
+		envField{"MCP_ES_POLICY_ALLOW_LEADING_WILDCARDS", &policy.AllowLeadingWildcards},
+		envField{"MCP_ES_POLICY_MAX_AGGREGATION_DEPTH", &policy.MaxAggregationDepth},
+		envField{"MCP_ES_POLICY_MAX_BUCKET_SIZE", &policy.MaxBucketSize},
+	); err != nil {
+		return err
+	}
+	if denied := getEnv("MCP_ES_POLICY_DENIED_QUERIES", ""); denied != "" {
+		policy.DeniedQueries = splitList(denied)
+	}
+
+	// Simple redaction rules applying to every index; rules restricted to
+	// some indices or using regular expressions need the configuration file.
+	for _, action := range []string{redactDrop, redactHash, redactMask} {
+		fields := splitList(getEnv("MCP_ES_REDACT_"+strings.ToUpper(action), ""))
+		if len(fields) > 0 {
+			config.Redaction.Rules = append(config.Redaction.Rules, RedactionRule{
+				Fields: fields,
+				Action: action,
+			})
+		}
+	}
+	if err := loadSecrets(
+		secretField{"MCP_ES_REDACT_HASH_SALT", &config.Redaction.HashSalt},
+	); err != nil {
+		return err
+	}
+
+	if err := loadEnv(
+		envField{"MCP_ES_AUDIT_ENABLED", &config.Audit.Enabled},
+		envField{"MCP_ES_AUDIT_REDACT_VALUES", &config.Audit.RedactValues},
+	); err != nil {
+		return err
+	}
+	config.Audit.Output = getEnv("MCP_ES_AUDIT_OUTPUT", config.Audit.Output)
+	if args := getEnv("MCP_ES_AUDIT_REDACT_ARGUMENTS", ""); args != "" {
+		config.Audit.RedactArguments = splitList(args)
+	}
+
+	if err := applyLimitEnv(&config.RateLimit.Global, "MCP_ES_RATE_LIMIT_"); err != nil {
+		return err
+	}
+	if err := applyLimitEnv(&config.RateLimit.PerClient, "MCP_ES_CLIENT_RATE_LIMIT_"); err != nil {
+		return err
+	}
+
+	budget := &config.QueryBudget.BudgetConfig
+	if err := loadEnv(
+		envField{"MCP_ES_QUERY_TIMEOUT", &budget.Timeout},
+		envField{"MCP_ES_QUERY_MAX_TIMEOUT", &budget.MaxTimeout},
+		envField{"MCP_ES_TERMINATE_AFTER", &budget.TerminateAfter},
+		envField{"MCP_ES_MAX_TERMINATE_AFTER", &budget.MaxTerminateAfter},
+	); err != nil {
+		return err
+	}
+
+	if err := loadEnv(
+		envField{"MCP_ES_CURSOR_KEEP_ALIVE", &config.Pagination.KeepAlive},
+		envField{"MCP_ES_MAX_CURSORS", &config.Pagination.MaxCursors},
+	); err != nil {
+		return err
+	}
+
+	if err := loadEnv(
+		envField{"MCP_ES_ESQL_MAX_ROWS", &config.ESQL.MaxRows},
+		envField{"MCP_ES_SQL_MAX_FETCH_SIZE", &config.SQL.MaxFetchSize},
+	); err != nil {
+		return err
+	}
+
+	if err := loadEnv(
+		envField{"MCP_ES_ASYNC_WAIT", &config.Async.WaitForCompletion},
+		envField{"MCP_ES_ASYNC_KEEP_ALIVE", &config.Async.KeepAlive},
+		envField{"MCP_ES_ASYNC_MAX_RUNNING", &config.Async.MaxRunning},
+	); err != nil {
+		return err
+	}
+
+	config.Semantic.InferenceID = getEnv("MCP_ES_SEMANTIC_INFERENCE_ID", config.Semantic.InferenceID)
+
+	config.Logging.Level = getEnv("MCP_ES_LOG_LEVEL", config.Logging.Level)
+	config.Logging.Format = getEnv("MCP_ES_LOG_FORMAT", config.Logging.Format)
+	config.Logging.Output = getEnv("MCP_ES_LOG_OUTPUT", config.Logging.Output)
+
+	return applyClusterEnv(config)
+}
+
+// applyLimitEnv overrides a rate limit with the prefixed RPM, BURST and
+// MAX_IN_FLIGHT variables.
+func applyLimitEnv(limit *LimitConfig, prefix string) error {
+	return loadEnv(
+		envField{prefix + "RPM", &limit.RequestsPerMinute},
+		envField{prefix + "BURST", &limit.Burst},
+		envField{prefix + "MAX_IN_FLIGHT", &limit.MaxInFlight},
+	)
+}
+
+// applyClusterEnv overrides the Elasticsearch cluster profiles with the
+// environment. ES_CLUSTERS=prod,staging replaces the set of clusters, reusing
+// the settings of same-named clusters from the configuration file. Each
+// cluster then reads its own prefixed variables, e.g. ES_PROD_URL and
+// ES_STAGING_API_KEY. When no cluster is configured at all, a single
+// "default" cluster is read from ES_URL, ES_API_KEY, etc.
+func applyClusterEnv(config *Config) error {
+	if names := splitList(getEnv("ES_CLUSTERS", "")); len(names) > 0 {
+		existing := make(map[string]ElasticsearchConfig, len(config.Clusters))
+		for _, clusterCfg := range config.Clusters {
+			existing[clusterCfg.Name] = clusterCfg
+		}
+
+		config.Clusters = make([]ElasticsearchConfig, 0, len(names))
+		for _, name := range names {
+			clusterCfg, ok := existing[name]
+			if !ok {
+				clusterCfg = ElasticsearchConfig{Name: name}
+			}
+			config.Clusters = append(config.Clusters, clusterCfg)
+		}
+	} else if len(config.Clusters) == 0 {
+		config.Clusters = []ElasticsearchConfig{{Name: defaultClusterName}}
+	}
+
+	for i := range config.Clusters {
+		if err := applyClusterConfigEnv(&config.Clusters[i]); err != nil {
+			return fmt.Errorf("cluster %q: %w", config.Clusters[i].Name, err)
+		}
+	}
+
+	if config.DefaultCluster == "" {
+		config.DefaultCluster = config.Clusters[0].Name
+	}
+	config.DefaultCluster = getEnv("ES_DEFAULT_CLUSTER", config.DefaultCluster)
+
+	return nil
+}
+
+func applyClusterConfigEnv(cfg *ElasticsearchConfig) error {
+	prefix := clusterEnvPrefix(cfg.Name)
+
+	cfg.URL = getEnv(prefix+"URL", cfg.URL)
+	cfg.CloudID = getEnv(prefix+"CLOUD_ID", cfg.CloudID)
+	cfg.Auth = getEnv(prefix+"AUTH", cfg.Auth)
+
+	cfg.CACertFile = getEnv(prefix+"CA_CERT", cfg.CACertFile)
+	cfg.CAFingerprint = getEnv(prefix+"CA_FINGERPRINT", cfg.CAFingerprint)
+	cfg.ClientCertFile = getEnv(prefix+"CLIENT_CERT", cfg.ClientCertFile)
+	cfg.ClientKeyFile = getEnv(prefix+"CLIENT_KEY", cfg.ClientKeyFile)
+	if err := loadEnv(
+		envField{prefix + "INSECURE_SKIP_VERIFY", &cfg.InsecureSkipVerify},
+	); err != nil {
+		return err
+	}
+
+	if err := loadSecrets(
+		secretField{prefix + "API_KEY", &cfg.APIKey},
+		secretField{prefix + "USERNAME", &cfg.Username},
+		secretField{prefix + "PASSWORD", &cfg.Password},
+		secretField{prefix + "SERVICE_TOKEN", &cfg.ServiceToken},
+		secretField{prefix + "BEARER_TOKEN", &cfg.BearerToken},
+	); err != nil {
+		return err
+	}
+
+	// The unnamed single-cluster setup keeps defaulting to a local node.
+	if cfg.Name == defaultClusterName && cfg.URL == "" && cfg.CloudID == "" {
+		cfg.URL = "http://localhost:9200"
+	}
+
+	return nil
+}
+
+// clusterEnvPrefix returns the environment variable prefix of a named
+// cluster: "logs-eu" becomes "ES_LOGS_EU_". The "default" cluster uses the
+// unprefixed ES_URL, ES_API_KEY, etc.
+func clusterEnvPrefix(name string) string {
+	if name == defaultClusterName {
+		return "ES_"
+	}
+	return "ES_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name)) + "_"
+}
+
+// configKey names a setting in validation errors by both its configuration
+// file key and its environment variable.
+func configKey(path, env string) string {
+	return fmt.Sprintf("%s (%s)", path, env)
+}
+
+// key names a setting of the cluster in validation errors.
+func (cfg ElasticsearchConfig) key(field string) string {
+	return configKey(
+		fmt.Sprintf("clusters.%s.%s", cfg.Name, field),
+		clusterEnvPrefix(cfg.Name)+strings.ToUpper(field),
+	)
+}
+
+func validateClusterConfig(cfg ElasticsearchConfig) error {
+	if cfg.URL == "" && cfg.CloudID == "" {
+		return fmt.Errorf("either %s or %s is required", cfg.key("url"), cfg.key("cloud_id"))
+	}
+	if cfg.URL != "" && cfg.CloudID != "" {
+		return fmt.Errorf("%s and %s are mutually exclusive", cfg.key("url"), cfg.key("cloud_id"))
+	}
+
+	switch cfg.authMethod() {
+	case esAuthAPIKey:
+		if cfg.APIKey == "" {
+			return fmt.Errorf("%s is required for api_key authentication", cfg.key("api_key"))
+		}
+	case esAuthBasic:
+		if cfg.Username == "" || cfg.Password == "" {
+			return fmt.Errorf(
+				"%s and %s are required for basic authentication",
+				cfg.key("username"), cfg.key("password"),
+			)
+		}
+	case esAuthServiceToken:
+		if cfg.ServiceToken == "" {
+			return fmt.Errorf(
+				"%s is required for service_token authentication",
+				cfg.key("service_token"),
+			)
+		}
+	case esAuthBearer:
+		if cfg.BearerToken == "" {
+			return fmt.Errorf("%s is required for bearer authentication", cfg.key("bearer_token"))
+		}
+	case esAuthNone:
+	case "":
+		return fmt.Errorf(
+			"one of %s, %s+%s, %s or %s must be provided, or set %s to none",
+			cfg.key("api_key"), cfg.key("username"), cfg.key("password"),
+			cfg.key("service_token"), cfg.key("bearer_token"), cfg.key("auth"),
+		)
+	default:
+		return fmt.Errorf(
+			"invalid %s: %s (expected api_key, basic, service_token, bearer or none)",
+			cfg.key("auth"), cfg.Auth,
+		)
+	}
+
+	if cfg.InsecureSkipVerify && (cfg.CACertFile != "" || cfg.CAFingerprint != "") {
+		return fmt.Errorf(
+			"%s cannot be combined with %s or %s",
+			cfg.key("insecure_skip_verify"), cfg.key("ca_cert"), cfg.key("ca_fingerprint"),
+		)
+	}
+
+	// A pinned fingerprint replaces chain verification against a CA
+	// bundle, so the bundle would go unused.
+	if cfg.CACertFile != "" && cfg.CAFingerprint != "" {
+		return fmt.Errorf("%s and %s are mutually exclusive", cfg.key("ca_cert"), cfg.key("ca_fingerprint"))
+	}
+
+	if (cfg.ClientCertFile == "") != (cfg.ClientKeyFile == "") {
+		return fmt.Errorf(
+			"%s and %s must be provided together",
+			cfg.key("client_cert"), cfg.key("client_key"),
+		)
+	}
+
+	if cfg.hasTLSSettings() {
+		if _, err := newTLSConfig(cfg); err != nil {
+			return fmt.Errorf("invalid TLS configuration: %w", err)
+		}
+	}
+
+	return nil
 }
 
 func validateConfig(config *Config) error {
-	if config.Elasticsearch.URL == "" {
-		return fmt.Errorf("ES_URL environment variable is required")
+	if len(config.Clusters) == 0 {
+		return fmt.Errorf("at least one Elasticsearch cluster must be configured")
+	}
+
+	seen := make(map[string]bool, len(config.Clusters))
+	for i, clusterCfg := range config.Clusters {
+		if clusterCfg.Name == "" {
+			return fmt.Errorf("clusters[%d].name is required", i)
+		}
+		if seen[clusterCfg.Name] {
+			return fmt.Errorf("duplicate cluster name in clusters (ES_CLUSTERS): %s", clusterCfg.Name)
+		}
+		seen[clusterCfg.Name] = true
+
+		if err := validateClusterConfig(clusterCfg); err != nil {
+			return fmt.Errorf("cluster %q: %w", clusterCfg.Name, err)
+		}
+	}
+
+	if !seen[config.DefaultCluster] {
+		return fmt.Errorf(
+			"%s %q is not a configured cluster",
+			configKey("default_cluster", "ES_DEFAULT_CLUSTER"), config.DefaultCluster,
+		)
+	}
+
+	switch config.Server.Transport {
+	case transportStdio, transportSSE, transportStreamableHTTP:
+	default:
+		return fmt.Errorf(
+			"invalid %s: %s (expected %s, %s or %s)",
+			configKey("server.transport", "MCP_ES_TRANSPORT"), config.Server.Transport,
+			transportStdio, transportSSE, transportStreamableHTTP,
+		)
+	}
+
+	if config.Server.Transport != transportStdio && config.Server.ListenAddr == "" {
+		return fmt.Errorf(
+			"%s is required for the %s transport",
+			configKey("server.listen_addr", "MCP_ES_LISTEN_ADDR"), config.Server.Transport,
+		)
 	}
 
-	// Either API key or username/password authentication must be provided
-	if config.Elasticsearch.APIKey == "" &&
-		(config.Elasticsearch.Username == "" || config.Elasticsearch.Password == "") {
-		return fmt.Errorf("either ES_API_KEY or ES_USERNAME+ES_PASSWORD must be provided")
+	if config.Server.ShutdownTimeout <= 0 {
+		return fmt.Errorf(
+			"%s must be greater than zero",
+			configKey("server.shutdown_timeout", "MCP_ES_SHUTDOWN_TIMEOUT"),
+		)
+	}
+
+	switch config.Auth.Mode {
+	case authModeNone:
+	case authModeStatic:
+		if len(config.Auth.Tokens) == 0 {
+			return fmt.Errorf(
+				"%s is required for static authentication",
+				configKey("auth.tokens", "MCP_ES_AUTH_TOKENS"),
+			)
+		}
+	case authModeHMAC:
+		if config.Auth.HMACSecret == "" {
+			return fmt.Errorf(
+				"%s is required for HMAC authentication",
+				configKey("auth.hmac_secret", "MCP_ES_AUTH_HMAC_SECRET"),
+			)
+		}
+	case authModeJWT:
+		if config.Auth.JWKSFile == "" {
+			return fmt.Errorf(
+				"%s is required for JWT authentication",
+				configKey("auth.jwks_file", "MCP_ES_AUTH_JWKS_FILE"),
+			)
+		}
+	default:
+		return fmt.Errorf(
+			"invalid %s: %s",
+			configKey("auth.mode", "MCP_ES_AUTH_MODE"), config.Auth.Mode,
+		)
+	}
+
+	if config.Auth.Mode != authModeNone && config.Server.Transport == transportStdio {
+		return fmt.Errorf(
+			"%s=%s requires an HTTP transport",
+			configKey("auth.mode", "MCP_ES_AUTH_MODE"), config.Auth.Mode,
+		)
+	}
+
+	if config.SearchPolicy.MaxAggregationDepth < 0 {
+		return fmt.Errorf(
+			"%s must not be negative",
+			configKey("search_policy.max_aggregation_depth", "MCP_ES_POLICY_MAX_AGGREGATION_DEPTH"),
+		)
+	}
+	if config.SearchPolicy.MaxBucketSize < 0 {
+		return fmt.Errorf(
+			"%s must not be negative",
+			configKey("search_policy.max_bucket_size", "MCP_ES_POLICY_MAX_BUCKET_SIZE"),
+		)
+	}
+
+	if _, err := newRedactor(config.Redaction); err != nil {
+		return err
+	}
+
+	if config.Audit.Enabled {
+		if config.Audit.Output == "" {
+			return fmt.Errorf(
+				"%s is required when auditing is enabled",
+				configKey("audit.output", "MCP_ES_AUDIT_OUTPUT"),
+			)
+		}
+		if config.Audit.Output == "stdout" && config.Server.Transport == transportStdio {
+			return fmt.Errorf(
+				"%s cannot be stdout with the stdio transport",
+				configKey("audit.output", "MCP_ES_AUDIT_OUTPUT"),
+			)
+		}
+	}
+
+	if err := validateLimitConfig(
+		config.RateLimit.Global, "rate_limit.global", "MCP_ES_RATE_LIMIT_",
+	); err != nil {
+		return err
+	}
+	if err := validateLimitConfig(
+		config.RateLimit.PerClient, "rate_limit.per_client", "MCP_ES_CLIENT_RATE_LIMIT_",
+	); err != nil {
+		return err
+	}
+	for tool, limit := range config.RateLimit.Tools {
+		if !slices.Contains(toolNames, tool) {
+			return fmt.Errorf(
+				"invalid rate_limit.tools: unknown tool %q (available: %s)",
+				tool, strings.Join(toolNames, ", "),
+			)
+		}
+		if err := validateLimitConfig(limit, "rate_limit.tools."+tool, ""); err != nil {
+			return err
+		}
+	}
+
+	if err := validateBudgetConfig(config.QueryBudget.BudgetConfig, "query_budget", true); err != nil {
+		return err
+	}
+	for tool, budget := range config.QueryBudget.Tools {
+		if err := validateBudgetConfig(budget, "query_budget.tools."+tool, false); err != nil {
+			return err
+		}
+	}
+
+	if config.Pagination.KeepAlive <= 0 {
+		return fmt.Errorf(
+			"%s must be greater than zero",
+			configKey("pagination.keep_alive", "MCP_ES_CURSOR_KEEP_ALIVE"),
+		)
+	}
+	if config.Pagination.MaxCursors <= 0 {
+		return fmt.Errorf(
+			"%s must be greater than zero",
+			configKey("pagination.max_cursors", "MCP_ES_MAX_CURSORS"),
+		)
+	}
+
+	if config.ESQL.MaxRows <= 0 {
+		return fmt.Errorf(
+			"%s must be greater than zero",
+			configKey("esql.max_rows", "MCP_ES_ESQL_MAX_ROWS"),
+		)
+	}
+	if config.SQL.MaxFetchSize <= 0 {
+		return fmt.Errorf(
+			"%s must be greater than zero",
+			configKey("sql.max_fetch_size", "MCP_ES_SQL_MAX_FETCH_SIZE"),
+		)
+	}
+
+	if config.Async.WaitForCompletion < 0 {
+		return fmt.Errorf(
+			"%s must not be negative",
+			configKey("async.wait_for_completion", "MCP_ES_ASYNC_WAIT"),
+		)
+	}
+	if config.Async.KeepAlive <= 0 {
+		return fmt.Errorf(
+			"%s must be greater than zero",
+			configKey("async.keep_alive", "MCP_ES_ASYNC_KEEP_ALIVE"),
+		)
+	}
+	if config.Async.MaxRunning <= 0 {
+		return fmt.Errorf(
+			"%s must be greater than zero",
+			configKey("async.max_running", "MCP_ES_ASYNC_MAX_RUNNING"),
+		)
 	}
 
 	validLogLevels := map[string]bool{
 		"debug": true, "info": true, "warn": true, "error": true, "fatal": true,
 	}
 	if !validLogLevels[config.Logging.Level] {
-		return fmt.Errorf("invalid log level: %s", config.Logging.Level)
+		return fmt.Errorf(
+			"invalid %s: %s",
+			configKey("logging.level", "MCP_ES_LOG_LEVEL"), config.Logging.Level,
+		)
 	}
 
 	return nil
 }
 
+func validateLimitConfig(limit LimitConfig, path, envPrefix string) error {
+	key := func(field, env string) string {
+		if envPrefix == "" {
+			return path + "." + field
+		}
+		return configKey(path+"."+field, envPrefix+env)
+	}
+
+	if limit.RequestsPerMinute < 0 {
+		return fmt.Errorf("%s must not be negative", key("requests_per_minute", "RPM"))
+	}
+	if limit.Burst < 0 {
+		return fmt.Errorf("%s must not be negative", key("burst", "BURST"))
+	}
+	if limit.MaxInFlight < 0 {
+		return fmt.Errorf("%s must not be negative", key("max_in_flight", "MAX_IN_FLIGHT"))
+	}
+	return nil
+}
+
+func validateBudgetConfig(budget BudgetConfig, path string, hasEnv bool) error {
+	key := func(field, env string) string {
+		if !hasEnv {
+			return path + "." + field
+		}
+		return configKey(path+"."+field, env)
+	}
+
+	if budget.Timeout < 0 {
+		return fmt.Errorf("%s must not be negative", key("timeout", "MCP_ES_QUERY_TIMEOUT"))
+	}
+	if budget.MaxTimeout < 0 {
+		return fmt.Errorf("%s must not be negative", key("max_timeout", "MCP_ES_QUERY_MAX_TIMEOUT"))
+	}
+	if budget.TerminateAfter < 0 {
+		return fmt.Errorf("%s must not be negative", key("terminate_after", "MCP_ES_TERMINATE_AFTER"))
+	}
+	if budget.MaxTerminateAfter < 0 {
+		return fmt.Errorf(
+			"%s must not be negative",
+			key("max_terminate_after", "MCP_ES_MAX_TERMINATE_AFTER"),
+		)
+	}
+	return nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -89,20 +735,66 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-func getBoolEnv(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
-		if parsed, err := strconv.ParseBool(value); err == nil {
-			return parsed
+// envField is a setting read from a variable; dst is a *bool, *int or
+// *time.Duration.
+type envField struct {
+	key string
+	dst any
+}
+
+// loadEnv overrides each field whose variable is set. A value that does not
+// parse is an error naming the variable, not a silent fallback to the
+// default.
+func loadEnv(fields ...envField) error {
+	for _, field := range fields {
+		value := os.Getenv(field.key)
+		if value == "" {
+			continue
+		}
+
+		switch dst := field.dst.(type) {
+		case *bool:
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %q is not a boolean", field.key, value)
+			}
+			*dst = parsed
+		case *int:
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %q is not an integer", field.key, value)
+			}
+			*dst = parsed
+		case *time.Duration:
+			parsed, err := parseEnvDuration(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %q is not a duration such as 30s", field.key, value)
+			}
+			*dst = parsed
+		default:
+			panic(fmt.Sprintf("unsupported type %T for %s", field.dst, field.key))
 		}
 	}
-	return defaultValue
+	return nil
 }
 
-func getIntEnv(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if parsed, err := strconv.Atoi(value); err == nil {
-			return parsed
+// parseEnvDuration parses a duration such as "1m30s". Bare integers are
+// taken as seconds.
+func parseEnvDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// splitList splits a comma separated value, trimming whitespace and dropping
+// empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
 	}
-	return defaultValue
+	return items
 }
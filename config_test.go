@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		dst     any
+		want    any
+		wantErr string
+	}{
+		{name: "unset keeps value", value: "", dst: ptr(5 * time.Second), want: 5 * time.Second},
+		{name: "bare seconds", value: "30", dst: ptr(time.Duration(0)), want: 30 * time.Second},
+		{name: "duration with unit", value: "500ms", dst: ptr(time.Duration(0)), want: 500 * time.Millisecond},
+		{name: "invalid duration", value: "abc", dst: ptr(time.Duration(0)), wantErr: "not a duration"},
+		{name: "bool", value: "true", dst: ptr(false), want: true},
+		{name: "invalid bool", value: "ture", dst: ptr(false), wantErr: "not a boolean"},
+		{name: "int", value: "42", dst: ptr(0), want: 42},
+		{name: "invalid int", value: "4x", dst: ptr(0), wantErr: "not an integer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MCP_ES_TEST_VALUE", tt.value)
+
+			err := loadEnv(envField{"MCP_ES_TEST_VALUE", tt.dst})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) ||
+					!strings.Contains(err.Error(), "MCP_ES_TEST_VALUE") {
+					t.Fatalf("loadEnv() error = %v, want one naming the variable and containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadEnv() error = %v", err)
+			}
+
+			var got any
+			switch dst := tt.dst.(type) {
+			case *time.Duration:
+				got = *dst
+			case *bool:
+				got = *dst
+			case *int:
+				got = *dst
+			}
+			if got != tt.want {
+				t.Errorf("loadEnv() set %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestValidateConfigRateLimitTools(t *testing.T) {
+	tests := []struct {
+		name    string
+		tools   map[string]LimitConfig
+		wantErr string
+	}{
+		{name: "no tool limits"},
+		{name: "known tool", tools: map[string]LimitConfig{"search": {RequestsPerMinute: 60}}},
+		{name: "unknown tool", tools: map[string]LimitConfig{"serach": {RequestsPerMinute: 60}}, wantErr: `unknown tool "serach"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := defaultConfig()
+			config.Clusters = []ElasticsearchConfig{{Name: "default", URL: "http://localhost:9200", Auth: esAuthNone}}
+			config.DefaultCluster = "default"
+			config.RateLimit.Tools = tt.tools
+
+			err := validateConfig(config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateConfig() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validateConfig() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
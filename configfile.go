@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redactedValue = "<redacted>"
+
+// Flags holds the command line flags. Flags that are set take precedence
+// over both the configuration file and the environment.
+type Flags struct {
+	ConfigFile  string
+	PrintConfig bool
+
+	overrides []func(*Config) error
+}
+
+// configFlags are the command line flags that override configuration
+// settings, keyed by flag name.
+var configFlags = []struct {
+	name  string
+	usage string
+	set   func(cfg *Config, value string) error
+}{
+	{"transport", "MCP transport: stdio, sse or streamable-http", func(cfg *Config, v string) error {
+		cfg.Server.Transport = v
+		return nil
+	}},
+	{"listen-addr", "Listen address for the HTTP transports", func(cfg *Config, v string) error {
+		cfg.Server.ListenAddr = v
+		return nil
+	}},
+	{"base-path", "Base path for the HTTP transports", func(cfg *Config, v string) error {
+		cfg.Server.BasePath = v
+		return nil
+	}},
+	{"public-url", "Public base URL advertised to SSE clients", func(cfg *Config, v string) error {
+		cfg.Server.PublicURL = v
+		return nil
+	}},
+	{"shutdown-timeout", "Graceful shutdown timeout (e.g. 10s)", func(cfg *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid -shutdown-timeout: %w", err)
+		}
+		cfg.Server.ShutdownTimeout = d
+		return nil
+	}},
+	{"default-cluster", "Cluster used when a tool call does not name one", func(cfg *Config, v string) error {
+		cfg.DefaultCluster = v
+		return nil
+	}},
+	{"auth-mode", "HTTP authentication: none, static, hmac or jwt", func(cfg *Config, v string) error {
+		cfg.Auth.Mode = v
+		return nil
+	}},
+	{"log-level", "Log level: debug, info, warn, error or fatal", func(cfg *Config, v string) error {
+		cfg.Logging.Level = v
+		return nil
+	}},
+	{"log-format", "Log format: json or console", func(cfg *Config, v string) error {
+		cfg.Logging.Format = v
+		return nil
+	}},
+}
+
+func parseFlags(args []string) (*Flags, error) {
+	fs := flag.NewFlagSet("mcp-elasticsearch", flag.ContinueOnError)
+
+	flags := &Flags{}
+	fs.StringVar(&flags.ConfigFile, "config", "", "Path to a YAML configuration file (env: MCP_ES_CONFIG)")
+	fs.BoolVar(
+		&flags.PrintConfig,
+		"print-config",
+		false,
+		"Print the effective configuration with secrets redacted and exit",
+	)
+
+	values := make(map[string]*string, len(configFlags))
+	for _, f := range configFlags {
+		values[f.name] = fs.String(f.name, "", f.usage)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	for _, f := range configFlags {
+		if !set[f.name] {
+			continue
+		}
+		value, setter := *values[f.name], f.set
+		flags.overrides = append(flags.overrides, func(cfg *Config) error {
+			return setter(cfg, value)
+		})
+	}
+
+	return flags, nil
+}
+
+func (f *Flags) apply(cfg *Config) error {
+	for _, override := range f.overrides {
+		if err := override(cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadConfigFile overlays the YAML configuration file at path onto cfg.
+// Unknown keys are rejected so that typos do not go unnoticed.
+func loadConfigFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening configuration file: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error parsing configuration file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// printConfig writes the effective configuration as YAML with every secret
+// replaced by a placeholder.
+func printConfig(w io.Writer, cfg *Config) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(cfg.redacted()); err != nil {
+		return fmt.Errorf("error encoding configuration: %w", err)
+	}
+	return encoder.Close()
+}
+
+// redacted returns a copy of the configuration without secret values.
+func (cfg Config) redacted() Config {
+	cfg.Clusters = append([]ElasticsearchConfig(nil), cfg.Clusters...)
+	for i := range cfg.Clusters {
+		c := &cfg.Clusters[i]
+		redact(&c.APIKey)
+		redact(&c.Password)
+		redact(&c.ServiceToken)
+		redact(&c.BearerToken)
+	}
+
+	cfg.Auth.Tokens = append([]string(nil), cfg.Auth.Tokens...)
+	for i, entry := range cfg.Auth.Tokens {
+		client, _, _ := strings.Cut(entry, ":")
+		cfg.Auth.Tokens[i] = client + ":" + redactedValue
+	}
+	redact(&cfg.Auth.HMACSecret)
+	redact(&cfg.Redaction.HashSalt)
+
+	return cfg
+}
+
+func redact(value *string) {
+	if *value != "" {
+		*value = redactedValue
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+type CountResponse struct {
+	Count           int            `json:"count"`
+	TerminatedEarly bool           `json:"terminated_early"`
+	Shards          map[string]any `json:"_shards"`
+}
+
+// maxBreakdownIndices caps the number of indices in the per-index breakdown
+// of a count.
+const maxBreakdownIndices = 1000
+
+// indexCount is the number of matching documents in one concrete index.
+type indexCount struct {
+	Index string `json:"index"`
+	Count int    `json:"count"`
+}
+
+// count runs the _count API for an index expression.
+func (c *cluster) count(
+	ctx context.Context,
+	index string,
+	body []byte,
+	budget queryBudget,
+) (*CountResponse, error) {
+	countOptions := []func(*esapi.CountRequest){
+		c.client.Count.WithContext(ctx),
+		c.client.Count.WithIndex(index),
+		c.client.Count.WithBody(strings.NewReader(string(body))),
+	}
+	if budget.TerminateAfter > 0 {
+		countOptions = append(countOptions, c.client.Count.WithTerminateAfter(budget.TerminateAfter))
+	}
+
+	res, err := c.client.Count(countOptions...)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var countResponse CountResponse
+	if err := json.NewDecoder(res.Body).Decode(&countResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &countResponse, nil
+}
+
+// countByIndex counts the documents matching query in each concrete index an
+// index expression resolves to, with a terms aggregation on _index. Indices
+// without matching documents are left out. truncated reports indices beyond
+// maxBreakdownIndices.
+func (c *cluster) countByIndex(
+	ctx context.Context,
+	index string,
+	query any,
+	budget queryBudget,
+) (counts []indexCount, truncated bool, err error) {
+	body, err := json.Marshal(map[string]any{
+		"size":             0,
+		"track_total_hits": false,
+		"query":            query,
+		"aggs": map[string]any{
+			"indices": map[string]any{
+				"terms": map[string]any{"field": "_index", "size": maxBreakdownIndices},
+			},
+		},
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	searchOptions := []func(*esapi.SearchRequest){
+		c.client.Search.WithContext(ctx),
+		c.client.Search.WithIndex(index),
+		c.client.Search.WithBody(strings.NewReader(string(body))),
+	}
+	if budget.TerminateAfter > 0 {
+		searchOptions = append(searchOptions, c.client.Search.WithTerminateAfter(budget.TerminateAfter))
+	}
+
+	res, err := c.client.Search(searchOptions...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, false, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var searchResponse struct {
+		Aggregations struct {
+			Indices struct {
+				SumOtherDocCount int `json:"sum_other_doc_count"`
+				Buckets          []struct {
+					Key      string `json:"key"`
+					DocCount int    `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"indices"`
+		} `json:"aggregations"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&searchResponse); err != nil {
+		return nil, false, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	indices := searchResponse.Aggregations.Indices
+	counts = make([]indexCount, len(indices.Buckets))
+	for i, bucket := range indices.Buckets {
+		counts[i] = indexCount{Index: bucket.Key, Count: bucket.DocCount}
+	}
+	return counts, indices.SumOtherDocCount > 0, nil
+}
+
+func (h *ElasticsearchHandler) handleCount(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+
+	index, err := request.RequireString("index")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing index parameter")
+		return mcp.NewToolResultError("Missing 'index' parameter"), nil
+	}
+
+	c, err := h.clusterFor(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, budget, err := h.queryBudget(ctx, "count", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
+	queryString := request.GetString("query", "{}")
+
+	log.Info().Str("index", index).Str("query", queryString).Msg("Counting documents")
+
+	query, err := parseQuery(queryString)
+	if err != nil {
+		log.Error().Err(err).Str("query", queryString).Msg("Invalid query JSON")
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid query JSON: %v", err)), nil
+	}
+	countRequest := map[string]any{"query": query}
+
+	if result := h.checkIndexAccess(ctx, log, c, index); result != nil {
+		return result, nil
+	}
+
+	if violation := h.policy.check(countRequest); violation != nil {
+		log.Warn().
+			Str("index", index).
+			Str("rule", violation.Rule).
+			Str("path", violation.Path).
+			Msg("Count rejected by policy")
+		return violation.toolResult(), nil
+	}
+
+	auditRequest(ctx, index, countRequest)
+
+	countBody, err := json.Marshal(countRequest)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal count request")
+		return mcp.NewToolResultError("Failed to create count request"), nil
+	}
+
+	total, err := c.count(ctx, index, countBody, budget)
+	if err != nil {
+		log.Error().Err(err).Str("index", index).Msg("Failed to count documents")
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to count documents: %v", err)), nil
+	}
+
+	response := map[string]any{
+		"cluster":          c.name,
+		"index":            index,
+		"count":            total.Count,
+		"terminated_early": total.TerminatedEarly,
+		"shards":           total.Shards,
+		"budget":           budget.response(),
+	}
+
+	// Break the count down by the concrete indices the expression resolves
+	// to, e.g. the backing indices of a data stream. Exclusions such as
+	// "-logs-old" are applied by Elasticsearch, so they never show up here.
+	breakdown, truncated, err := c.countByIndex(ctx, index, query, budget)
+	if err != nil {
+		log.Warn().Err(err).Str("index", index).Msg("Failed to count documents per index")
+		response["breakdown_error"] = err.Error()
+	} else if len(breakdown) > 1 || truncated {
+		response["breakdown"] = breakdown
+		response["breakdown_truncated"] = truncated
+	}
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal count response")
+		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+	}
+
+	log.Info().
+		Str("index", index).
+		Int("count", total.Count).
+		Int("indices", len(breakdown)).
+		Msg("Counted documents successfully")
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClusterCountByIndex(t *testing.T) {
+	var gotPath string
+	var gotBody map[string]any
+	c := newTestCluster(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+		_, _ = w.Write([]byte(`{"aggregations": {"indices": {"sum_other_doc_count": 0, "buckets": [
+			{"key": ".ds-logs-app-2024.01.01-000001", "doc_count": 7},
+			{"key": ".ds-logs-app-2024.01.02-000002", "doc_count": 3}
+		]}}}`))
+	})
+
+	counts, truncated, err := c.countByIndex(context.Background(), "logs-app,-logs-old", map[string]any{"match_all": map[string]any{}}, queryBudget{})
+	if err != nil {
+		t.Fatalf("countByIndex() error = %v", err)
+	}
+
+	if !strings.HasPrefix(gotPath, "/logs-app,-logs-old/_search") {
+		t.Errorf("searched %q, want the whole index expression", gotPath)
+	}
+	terms, _ := gotBody["aggs"].(map[string]any)["indices"].(map[string]any)["terms"].(map[string]any)
+	if terms["field"] != "_index" {
+		t.Errorf("breakdown aggregation = %v, want a terms aggregation on _index", gotBody["aggs"])
+	}
+
+	want := []indexCount{
+		{Index: ".ds-logs-app-2024.01.01-000001", Count: 7},
+		{Index: ".ds-logs-app-2024.01.02-000002", Count: 3},
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("countByIndex() = %v, want %v", counts, want)
+	}
+	if truncated {
+		t.Error("countByIndex() reported a truncated breakdown")
+	}
+}
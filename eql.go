@@ -0,0 +1,553 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultEQLTimestampField     = "@timestamp"
+	defaultEQLEventCategoryField = "event.category"
+)
+
+type EQLResponse struct {
+	ID        string `json:"id"`
+	IsRunning bool   `json:"is_running"`
+	IsPartial bool   `json:"is_partial"`
+	TimedOut  bool   `json:"timed_out"`
+	Took      int    `json:"took"`
+	Hits      struct {
+		Total *struct {
+			Value    int    `json:"value"`
+			Relation string `json:"relation"`
+		} `json:"total"`
+		Events    []map[string]any `json:"events"`
+		Sequences []struct {
+			JoinKeys []any            `json:"join_keys"`
+			Events   []map[string]any `json:"events"`
+		} `json:"sequences"`
+	} `json:"hits"`
+}
+
+// eqlSearch starts an EQL search. Searches still running after wait are
+// kept in Elasticsearch for keepAlive and their response carries an id.
+func (c *cluster) eqlSearch(
+	ctx context.Context,
+	index string,
+	body []byte,
+	wait time.Duration,
+	keepAlive time.Duration,
+) (*EQLResponse, error) {
+	res, err := c.client.EqlSearch(
+		index,
+		strings.NewReader(string(body)),
+		c.client.EqlSearch.WithContext(ctx),
+		c.client.EqlSearch.WithWaitForCompletionTimeout(wait),
+		c.client.EqlSearch.WithKeepAlive(keepAlive),
+		c.client.EqlSearch.WithKeepOnCompletion(false),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var eqlResponse EQLResponse
+	if err := json.NewDecoder(res.Body).Decode(&eqlResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &eqlResponse, nil
+}
+
+// eqlGet polls a running EQL search.
+func (c *cluster) eqlGet(
+	ctx context.Context,
+	id string,
+	wait time.Duration,
+	keepAlive time.Duration,
+) (*EQLResponse, error) {
+	res, err := c.client.EqlGet(
+		id,
+		c.client.EqlGet.WithContext(ctx),
+		c.client.EqlGet.WithWaitForCompletionTimeout(wait),
+		c.client.EqlGet.WithKeepAlive(keepAlive),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var eqlResponse EQLResponse
+	if err := json.NewDecoder(res.Body).Decode(&eqlResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &eqlResponse, nil
+}
+
+// deleteEQLSearch deletes a finished EQL search and its stored results.
+// Failures are only logged: Elasticsearch deletes it once its keep-alive
+// lapses anyway.
+func (h *ElasticsearchHandler) deleteEQLSearch(c *cluster, id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := c.client.EqlDelete(id, c.client.EqlDelete.WithContext(ctx))
+	if err != nil {
+		h.logger.Warn().Err(err).Str("cluster", c.name).Msg("Failed to delete EQL search")
+		return
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		h.logger.Warn().Str("cluster", c.name).Str("response", res.String()).Msg("Failed to delete EQL search")
+	}
+}
+
+func (h *ElasticsearchHandler) handleEQLSearch(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	if id := request.GetString("id", ""); id != "" {
+		return h.handleEQLPoll(ctx, request, id)
+	}
+
+	log := h.requestLogger(ctx)
+
+	index, err := request.RequireString("index")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing index parameter")
+		return mcp.NewToolResultError("Missing 'index' parameter"), nil
+	}
+	query, err := request.RequireString("query")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing query parameter")
+		return mcp.NewToolResultError("Missing 'query' parameter"), nil
+	}
+
+	c, err := h.clusterFor(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, budget, err := h.queryBudget(ctx, "eql_search", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
+	wait, err := h.async.waitForCompletion(request.GetString("wait_for_completion_timeout", ""), budget)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	size := request.GetInt("size", 10)
+	if size <= 0 {
+		return mcp.NewToolResultError("size must be greater than 0"), nil
+	}
+
+	params := map[string]string{
+		"query":                query,
+		"timestamp_field":      request.GetString("timestamp_field", defaultEQLTimestampField),
+		"event_category_field": request.GetString("event_category_field", defaultEQLEventCategoryField),
+	}
+	eqlRequest := map[string]any{
+		"query":                query,
+		"size":                 size,
+		"timestamp_field":      params["timestamp_field"],
+		"event_category_field": params["event_category_field"],
+	}
+	if tiebreaker := request.GetString("tiebreaker_field", ""); tiebreaker != "" {
+		eqlRequest["tiebreaker_field"] = tiebreaker
+	}
+
+	log.Info().Str("index", index).Str("query", query).Msg("Executing EQL search")
+
+	if filterString := request.GetString("filter", ""); filterString != "" {
+		var filter map[string]any
+		if err := json.Unmarshal([]byte(filterString), &filter); err != nil {
+			log.Error().Err(err).Str("filter", filterString).Msg("Invalid filter JSON")
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid filter JSON: %v", err)), nil
+		}
+		if violation := h.policy.check(map[string]any{"query": filter}); violation != nil {
+			log.Warn().
+				Str("index", index).
+				Str("rule", violation.Rule).
+				Str("path", violation.Path).
+				Msg("EQL filter rejected by policy")
+			return violation.toolResult(), nil
+		}
+		eqlRequest["filter"] = filter
+	}
+
+	if result := h.checkIndexAccess(ctx, log, c, index); result != nil {
+		return result, nil
+	}
+
+	auditRequest(ctx, index, eqlRequest)
+
+	body, err := json.Marshal(eqlRequest)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal EQL request")
+		return mcp.NewToolResultError("Failed to create EQL request"), nil
+	}
+
+	eqlResponse, err := c.eqlSearch(ctx, index, body, wait, h.async.KeepAlive)
+	if err != nil {
+		return eqlErrorResult(log, budget, err), nil
+	}
+
+	if eqlResponse.IsRunning && eqlResponse.ID != "" {
+		err := h.asyncTasks.put(&asyncTask{
+			id:       eqlResponse.ID,
+			tool:     "eql_search",
+			clientID: clientIdentityFromContext(ctx).ID,
+			cluster:  c.name,
+			index:    index,
+			params:   params,
+		})
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to track EQL search")
+			h.deleteEQLSearch(c, eqlResponse.ID)
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+
+	return h.eqlResult(ctx, log, c, index, params, eqlResponse)
+}
+
+// handleEQLPoll returns the results of an EQL search that was still running
+// when a previous call returned.
+func (h *ElasticsearchHandler) handleEQLPoll(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+	id string,
+) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+
+	task, err := h.asyncTasks.get(id, "eql_search", clientIdentityFromContext(ctx).ID)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	c, ok := h.clusters[task.cluster]
+	if !ok {
+		return mcp.NewToolResultError(errUnknownAsyncTask.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, budget, err := h.queryBudget(ctx, "eql_search", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
+	wait, err := h.async.waitForCompletion(request.GetString("wait_for_completion_timeout", ""), budget)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	log.Info().Str("index", task.index).Str("id", id).Msg("Polling EQL search")
+	auditRequest(ctx, task.index, nil)
+
+	eqlResponse, err := c.eqlGet(ctx, id, wait, h.async.KeepAlive)
+	if err != nil {
+		return eqlErrorResult(log, budget, err), nil
+	}
+
+	if eqlResponse.IsRunning {
+		// Polling extended the search's keep-alive.
+		if err := h.asyncTasks.put(task); err != nil {
+			log.Warn().Err(err).Msg("Failed to track EQL search")
+		}
+	} else {
+		h.asyncTasks.remove(id)
+		h.deleteEQLSearch(c, id)
+	}
+	eqlResponse.ID = id
+
+	return h.eqlResult(ctx, log, c, task.index, task.params, eqlResponse)
+}
+
+// eqlResult renders an EQL response. Events are listed with their
+// timestamp and category next to their source, and every sequence gets a
+// one-line summary of its events in order.
+func (h *ElasticsearchHandler) eqlResult(
+	ctx context.Context,
+	log zerolog.Logger,
+	c *cluster,
+	index string,
+	params map[string]string,
+	eqlResponse *EQLResponse,
+) (*mcp.CallToolResult, error) {
+	response := map[string]any{
+		"cluster":    c.name,
+		"index":      index,
+		"is_running": eqlResponse.IsRunning,
+		"is_partial": eqlResponse.IsPartial,
+		"timed_out":  eqlResponse.TimedOut,
+		"took":       eqlResponse.Took,
+	}
+	if eqlResponse.IsRunning {
+		response["id"] = eqlResponse.ID
+		response["message"] = "The search is still running; call eql_search again with this id to get its results"
+	}
+	if total := eqlResponse.Hits.Total; total != nil {
+		response["total_hits"] = total.Value
+		response["total_hits_relation"] = total.Relation
+	}
+
+	hits := slices.Clone(eqlResponse.Hits.Events)
+	for _, sequence := range eqlResponse.Hits.Sequences {
+		hits = append(hits, sequence.Events...)
+	}
+	names, errResult := h.redactionNames(ctx, log, c, hits)
+	if errResult != nil {
+		return errResult, nil
+	}
+
+	render := func(event map[string]any) map[string]any {
+		if missing, _ := event["missing"].(bool); missing {
+			return map[string]any{"missing": true}
+		}
+		if h.redactor.enabled() {
+			h.redactor.redactHit(event, names)
+		}
+		source, _ := event["_source"].(map[string]any)
+		return map[string]any{
+			"index":     event["_index"],
+			"id":        event["_id"],
+			"timestamp": lookupField(source, params["timestamp_field"]),
+			"category":  lookupField(source, params["event_category_field"]),
+			"source":    source,
+		}
+	}
+
+	if eqlResponse.Hits.Events != nil {
+		events := make([]map[string]any, 0, len(eqlResponse.Hits.Events))
+		for _, event := range eqlResponse.Hits.Events {
+			events = append(events, render(event))
+		}
+		response["events"] = events
+	}
+
+	if eqlResponse.Hits.Sequences != nil {
+		sequences := make([]map[string]any, 0, len(eqlResponse.Hits.Sequences))
+		joinFields := eqlJoinFields(params["query"])
+		for _, sequence := range eqlResponse.Hits.Sequences {
+			joinKeys := h.redactor.redactJoinKeys(sequence.JoinKeys, joinFields)
+			events := make([]map[string]any, 0, len(sequence.Events))
+			steps := make([]string, 0, len(sequence.Events))
+			for _, event := range sequence.Events {
+				rendered := render(event)
+				events = append(events, rendered)
+				steps = append(steps, eqlStep(rendered))
+			}
+
+			summary := strings.Join(steps, " -> ")
+			if len(joinKeys) > 0 {
+				keys := make([]string, len(joinKeys))
+				for i, key := range joinKeys {
+					keys[i] = scalarString(key)
+				}
+				summary = "[" + strings.Join(keys, ", ") + "] " + summary
+			}
+
+			sequences = append(sequences, map[string]any{
+				"join_keys": joinKeys,
+				"summary":   summary,
+				"events":    events,
+			})
+		}
+		response["sequences"] = sequences
+	}
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal EQL response")
+		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+	}
+
+	log.Info().
+		Str("index", index).
+		Bool("is_running", eqlResponse.IsRunning).
+		Int("events", len(eqlResponse.Hits.Events)).
+		Int("sequences", len(eqlResponse.Hits.Sequences)).
+		Int("took_ms", eqlResponse.Took).
+		Msg("EQL search executed successfully")
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
+
+// eqlStep describes a sequence event as "category@timestamp (index/id)".
+func eqlStep(event map[string]any) string {
+	if missing, _ := event["missing"].(bool); missing {
+		return "(missing)"
+	}
+
+	step := "event"
+	if category := event["category"]; category != nil {
+		step = scalarString(category)
+	}
+	if timestamp := event["timestamp"]; timestamp != nil {
+		step += "@" + scalarString(timestamp)
+	}
+	return fmt.Sprintf("%s (%v/%v)", step, event["index"], event["id"])
+}
+
+// eqlJoinFields returns the fields behind each join key of a sequence or
+// sample query: the fields of its shared "by" clause, then those of the "by"
+// clauses of its queries, which name the same key at the same position. It
+// returns nil for other queries.
+func eqlJoinFields(query string) [][]string {
+	keyword, rest := cutWord(strings.TrimSpace(query))
+	if keyword != "sequence" && keyword != "sample" {
+		return nil
+	}
+
+	// Split the query into the parts outside the bracketed queries: the
+	// header before the first query and the clauses after each one.
+	var (
+		segments []string
+		current  strings.Builder
+		depth    int
+	)
+	for i := 0; i < len(rest); i++ {
+		ch := rest[i]
+		switch {
+		case ch == '"' || ch == '`':
+			end := eqlQuoteEnd(rest, i)
+			if depth == 0 {
+				current.WriteString(rest[i:end])
+			}
+			i = end - 1
+		case ch == '[':
+			if depth == 0 {
+				segments = append(segments, current.String())
+				current.Reset()
+			}
+			depth++
+		case ch == ']':
+			depth--
+		case depth == 0:
+			current.WriteByte(ch)
+		}
+	}
+	segments = append(segments, current.String())
+
+	var shared []string
+	var perQuery [][]string
+	for i, segment := range segments {
+		fields := eqlByFields(segment)
+		if i == 0 {
+			shared = fields
+		} else if len(fields) > 0 {
+			perQuery = append(perQuery, fields)
+		}
+	}
+
+	joinFields := make([][]string, 0, len(shared))
+	for _, field := range shared {
+		joinFields = append(joinFields, []string{field})
+	}
+	if len(perQuery) > 0 {
+		for i := range perQuery[0] {
+			var fields []string
+			for _, list := range perQuery {
+				if i < len(list) {
+					fields = append(fields, list[i])
+				}
+			}
+			joinFields = append(joinFields, fields)
+		}
+	}
+	return joinFields
+}
+
+// eqlQuoteEnd returns the index just past the string or quoted field name
+// starting at start.
+func eqlQuoteEnd(s string, start int) int {
+	if strings.HasPrefix(s[start:], `"""`) {
+		if end := strings.Index(s[start+3:], `"""`); end >= 0 {
+			return start + 3 + end + 3
+		}
+		return len(s)
+	}
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// eqlByFields returns the fields of the "by" clause of a part of a sequence
+// query, such as "by user.name with maxspan=5m".
+func eqlByFields(segment string) []string {
+	var fields []string
+	inBy := false
+	for _, word := range strings.Fields(strings.ReplaceAll(segment, ",", " , ")) {
+		switch {
+		case word == "by":
+			inBy = true
+		case word == "with" || word == "until":
+			inBy = false
+		case inBy && word != ",":
+			fields = append(fields, strings.Trim(word, "`"))
+		}
+	}
+	return fields
+}
+
+// lookupField returns the value of a dotted field in a document, whether it
+// is stored as nested objects or under a dotted key.
+func lookupField(source map[string]any, field string) any {
+	if source == nil || field == "" {
+		return nil
+	}
+	if value, ok := source[field]; ok {
+		return value
+	}
+	for i := 0; i < len(field); i++ {
+		if field[i] != '.' {
+			continue
+		}
+		if child, ok := source[field[:i]].(map[string]any); ok {
+			if value := lookupField(child, field[i+1:]); value != nil {
+				return value
+			}
+		}
+	}
+	return nil
+}
+
+func eqlErrorResult(log zerolog.Logger, budget queryBudget, err error) *mcp.CallToolResult {
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Warn().Dur("timeout", budget.Timeout).Msg("EQL search exceeded its timeout")
+		return mcp.NewToolResultError(fmt.Sprintf(
+			"EQL search did not complete within its %s timeout; lower wait_for_completion_timeout to get an id to poll",
+			budget.Timeout,
+		))
+	}
+	log.Error().Err(err).Msg("Failed to execute EQL search")
+	return mcp.NewToolResultError(fmt.Sprintf("Failed to execute EQL search: %v", err))
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEQLJoinFields(t *testing.T) {
+	tests := []struct {
+		query string
+		want  [][]string
+	}{
+		{query: `process where process.name == "cmd.exe"`, want: nil},
+		{
+			query: `sequence by host.name [process where true] [network where true]`,
+			want:  [][]string{{"host.name"}},
+		},
+		{
+			query: `sequence by host.name with maxspan=5m [process where true] by user.name [network where true] by source.user`,
+			want:  [][]string{{"host.name"}, {"user.name", "source.user"}},
+		},
+		{
+			query: "sample [process where true] by `user.email` [file where name == \"[x] by y\"] by owner.email",
+			want:  [][]string{{"user.email", "owner.email"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := eqlJoinFields(tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("eqlJoinFields() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactJoinKeys(t *testing.T) {
+	r := mustRedactor(t, RedactionConfig{
+		Rules: []RedactionRule{{Fields: []string{"*.email"}, Action: redactMask}},
+	})
+
+	fields := [][]string{{"host.name"}, {"user.email", "owner.email"}}
+	got := r.redactJoinKeys([]any{"web-1", "alice@example.com"}, fields)
+	if got[0] != "web-1" || got[1] == "alice@example.com" {
+		t.Errorf("redactJoinKeys() = %v, want only the email key redacted", got)
+	}
+
+	if got := r.redactJoinKeys([]any{"web-1", "alice@example.com"}, fields[:1]); got != nil {
+		t.Errorf("redactJoinKeys() with unknown fields = %v, want nil", got)
+	}
+}
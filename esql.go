@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ESQLConfig configures the esql tool.
+type ESQLConfig struct {
+	// MaxRows caps the rows an ES|QL query may return. Callers may ask for
+	// fewer rows with the tool's limit argument.
+	MaxRows int `yaml:"max_rows"`
+}
+
+// tableColumn is a column of a tabular query result.
+type tableColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type ESQLResponse struct {
+	Columns   []tableColumn `json:"columns"`
+	Values    [][]any       `json:"values"`
+	Took      *int          `json:"took,omitempty"`
+	IsPartial bool          `json:"is_partial"`
+}
+
+// esqlSourceCommands are the ES|QL source commands that read indices.
+var esqlSourceCommands = map[string]bool{"from": true, "ts": true, "metrics": true}
+
+// esqlCommands splits an ES|QL query into its piped commands, ignoring pipes
+// inside strings, quoted identifiers and comments. Comments are dropped.
+func esqlCommands(query string) []string {
+	var (
+		commands []string
+		current  strings.Builder
+	)
+
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case strings.HasPrefix(query[i:], `"""`):
+			end := strings.Index(query[i+3:], `"""`)
+			if end < 0 {
+				end = len(query) - i - 3
+			} else {
+				end += 3
+			}
+			current.WriteString(query[i : i+3+end])
+			i += 2 + end
+		case ch == '"' || ch == '`':
+			j := i + 1
+			for j < len(query) && query[j] != ch {
+				if ch == '"' && query[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(query) {
+				j = len(query) - 1
+			}
+			current.WriteString(query[i : j+1])
+			i = j
+		case strings.HasPrefix(query[i:], "//"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			current.WriteByte(' ')
+			i += end - 1
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query) - i - 2
+			} else {
+				end += 2
+			}
+			current.WriteByte(' ')
+			i += 1 + end
+		case ch == '|':
+			commands = append(commands, strings.TrimSpace(current.String()))
+			current.Reset()
+		default:
+			current.WriteByte(ch)
+		}
+	}
+
+	return append(commands, strings.TrimSpace(current.String()))
+}
+
+// esqlSources returns the indices an ES|QL query reads from: the index
+// patterns of its source command and of LOOKUP JOIN commands. enrich reports
+// whether the query uses ENRICH, whose policies read indices of their own.
+func esqlSources(query string) (sources []string, enrich bool) {
+	for _, command := range esqlCommands(query) {
+		keyword, rest := cutWord(command)
+
+		switch keyword = strings.ToLower(keyword); {
+		case esqlSourceCommands[keyword]:
+			sources = append(sources, esqlIndexList(rest)...)
+		case keyword == "lookup":
+			if join, rest := cutWord(rest); strings.EqualFold(join, "join") {
+				sources = append(sources, esqlIndexList(rest)...)
+			}
+		case keyword == "enrich":
+			enrich = true
+		}
+	}
+	return sources, enrich
+}
+
+// cutWord splits s around the first run of whitespace.
+func cutWord(s string) (word, rest string) {
+	end := strings.IndexAny(s, " \t\r\n")
+	if end < 0 {
+		return s, ""
+	}
+	return s[:end], strings.TrimSpace(s[end:])
+}
+
+// esqlIndexList parses the comma-separated index patterns at the start of s,
+// as in "logs-*, metrics-* METADATA _index".
+func esqlIndexList(s string) []string {
+	var indices []string
+	for {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return indices
+		}
+
+		var name string
+		if s[0] == '"' {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				end = len(s) - 1
+			}
+			name, s = s[1:end+1], s[min(end+2, len(s)):]
+		} else {
+			end := strings.IndexAny(s, " \t\r\n,")
+			if end < 0 {
+				end = len(s)
+			}
+			name, s = s[:end], s[end:]
+		}
+		// Quoted names may hold several comma-separated patterns.
+		indices = append(indices, splitList(name)...)
+
+		s = strings.TrimSpace(s)
+		if !strings.HasPrefix(s, ",") {
+			return indices
+		}
+		s = s[1:]
+	}
+}
+
+// esqlQuery runs an ES|QL query.
+func (c *cluster) esqlQuery(ctx context.Context, body []byte) (*ESQLResponse, error) {
+	res, err := c.client.EsqlQuery(
+		strings.NewReader(string(body)),
+		c.client.EsqlQuery.WithContext(ctx),
+		c.client.EsqlQuery.WithFormat("json"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var esqlResponse ESQLResponse
+	if err := json.NewDecoder(res.Body).Decode(&esqlResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &esqlResponse, nil
+}
+
+func (h *ElasticsearchHandler) handleESQL(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+
+	query, err := request.RequireString("query")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing query parameter")
+		return mcp.NewToolResultError("Missing 'query' parameter"), nil
+	}
+
+	c, err := h.clusterFor(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, budget, err := h.queryBudget(ctx, "esql", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
+	limit := request.GetInt("limit", h.esql.MaxRows)
+	if limit <= 0 {
+		return mcp.NewToolResultError("limit must be greater than 0"), nil
+	}
+	limit = min(limit, h.esql.MaxRows)
+
+	log.Info().Str("query", query).Int("limit", limit).Msg("Executing ES|QL query")
+
+	sources, enrich := esqlSources(query)
+	if enrich && (h.indexAccess.enabled() || h.redactor.enabled()) {
+		return mcp.NewToolResultError(
+			"ENRICH is not supported while index access or redaction rules are configured",
+		), nil
+	}
+	index := strings.Join(sources, ",")
+	if index != "" {
+		if result := h.checkIndexAccess(ctx, log, c, index); result != nil {
+			return result, nil
+		}
+		if result := h.checkRedactedSources(ctx, log, c, index, "ES|QL"); result != nil {
+			return result, nil
+		}
+	}
+
+	// One row more than the limit is requested to tell whether the result
+	// was cut short. The LIMIT goes on its own line so that a trailing line
+	// comment cannot swallow it.
+	esqlRequest := map[string]any{
+		"query": query + "\n| LIMIT " + strconv.Itoa(limit+1),
+	}
+	if paramsString := request.GetString("params", ""); paramsString != "" {
+		var params []any
+		if err := json.Unmarshal([]byte(paramsString), &params); err != nil {
+			log.Error().Err(err).Str("params", paramsString).Msg("Invalid params JSON")
+			return mcp.NewToolResultError(
+				fmt.Sprintf("Invalid params JSON, expected an array: %v", err),
+			), nil
+		}
+		esqlRequest["params"] = params
+	}
+	if locale := request.GetString("locale", ""); locale != "" {
+		esqlRequest["locale"] = locale
+	}
+	if timeZone := request.GetString("time_zone", ""); timeZone != "" {
+		esqlRequest["time_zone"] = timeZone
+	}
+
+	auditRequest(ctx, index, esqlRequest)
+
+	body, err := json.Marshal(esqlRequest)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal ES|QL request")
+		return mcp.NewToolResultError("Failed to create ES|QL request"), nil
+	}
+
+	esqlResponse, err := c.esqlQuery(ctx, body)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Warn().Dur("timeout", budget.Timeout).Msg("ES|QL query exceeded its timeout")
+			return mcp.NewToolResultError(fmt.Sprintf(
+				"ES|QL query did not complete within its %s timeout; narrow the query or lower its limit",
+				budget.Timeout,
+			)), nil
+		}
+		log.Error().Err(err).Msg("Failed to execute ES|QL query")
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to execute ES|QL query: %v", err)), nil
+	}
+
+	rows := esqlResponse.Values
+	truncated := len(rows) > limit
+	if truncated {
+		rows = rows[:limit]
+	}
+	if rows == nil {
+		rows = [][]any{}
+	}
+
+	// terminate_after does not apply to ES|QL.
+	budgetResponse := budget.response()
+	delete(budgetResponse, "terminate_after")
+
+	response := map[string]any{
+		"cluster":    c.name,
+		"columns":    esqlResponse.Columns,
+		"rows":       rows,
+		"row_count":  len(rows),
+		"limit":      limit,
+		"truncated":  truncated,
+		"is_partial": esqlResponse.IsPartial,
+		"budget":     budgetResponse,
+	}
+	if index != "" {
+		response["index"] = index
+	}
+	if esqlResponse.Took != nil {
+		response["took"] = *esqlResponse.Took
+	}
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal ES|QL response")
+		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+	}
+
+	log.Info().
+		Int("rows", len(rows)).
+		Bool("truncated", truncated).
+		Msg("ES|QL query executed successfully")
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestESQLSources(t *testing.T) {
+	tests := []struct {
+		query      string
+		want       []string
+		wantEnrich bool
+	}{
+		{query: "FROM logs-*", want: []string{"logs-*"}},
+		{query: "from logs-*, metrics-* METADATA _index | LIMIT 10", want: []string{"logs-*", "metrics-*"}},
+		{query: `FROM "logs-*,traces-*" | KEEP message`, want: []string{"logs-*", "traces-*"}},
+		{query: "FROM logs | LOOKUP JOIN users ON user.id", want: []string{"logs", "users"}},
+		{query: "FROM logs | ENRICH hosts ON host.name", want: []string{"logs"}, wantEnrich: true},
+		{query: "TS metrics-tsdb | STATS max(cpu)", want: []string{"metrics-tsdb"}},
+		{query: `ROW a = "| FROM secret"`, want: nil},
+		{query: "FROM logs // | FROM secret\n| WHERE level == \"ERROR\"", want: []string{"logs"}},
+		{query: "FROM logs /* | FROM secret */ | LIMIT 1", want: []string{"logs"}},
+		{query: "FROM logs | WHERE message == \"\"\"a | FROM secret\"\"\"", want: []string{"logs"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, enrich := esqlSources(tt.query)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("esqlSources() = %q, want %q", got, tt.want)
+			}
+			if enrich != tt.wantEnrich {
+				t.Errorf("esqlSources() enrich = %v, want %v", enrich, tt.wantEnrich)
+			}
+		})
+	}
+}
+
+func TestCheckRedactedSources(t *testing.T) {
+	c := newTestCluster(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_resolve/index/users-stream":
+			_, _ = w.Write([]byte(`{"indices": [{"name": ".ds-users-stream-2024.01.01-000001", "data_stream": "users-stream"}]}`))
+		case "/_resolve/index/people":
+			_, _ = w.Write([]byte(`{"indices": [{"name": "hr-2024", "aliases": ["people"]}]}`))
+		default:
+			_, _ = w.Write([]byte(`{"indices": [{"name": "logs-app"}]}`))
+		}
+	})
+
+	tests := []struct {
+		name      string
+		rules     []RedactionRule
+		index     string
+		wantError bool
+	}{
+		{name: "no rules", index: "users-stream"},
+		{name: "rule for every index", rules: []RedactionRule{{Fields: []string{"email"}, Action: redactDrop}}, index: "logs-app", wantError: true},
+		{name: "other index", rules: []RedactionRule{{Indices: []string{"users-*"}, Fields: []string{"email"}, Action: redactDrop}}, index: "logs-app"},
+		{name: "data stream", rules: []RedactionRule{{Indices: []string{"users-*"}, Fields: []string{"email"}, Action: redactDrop}}, index: "users-stream", wantError: true},
+		{name: "alias", rules: []RedactionRule{{Indices: []string{"people"}, Fields: []string{"email"}, Action: redactDrop}}, index: "people", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &ElasticsearchHandler{redactor: mustRedactor(t, RedactionConfig{Rules: tt.rules})}
+			result := h.checkRedactedSources(context.Background(), zerolog.Nop(), c, tt.index, "ES|QL")
+			if got := result != nil; got != tt.wantError {
+				t.Errorf("checkRedactedSources(%q) refused = %v, want %v", tt.index, got, tt.wantError)
+			}
+		})
+	}
+}
@@ -6,9 +6,12 @@ toolchain go1.23.9
 
 require (
 	github.com/elastic/go-elasticsearch/v8 v8.18.0
+	github.com/golang-jwt/jwt/v5 v5.2.2
 	github.com/joho/godotenv v1.5.1
 	github.com/mark3labs/mcp-go v0.30.1
 	github.com/rs/zerolog v1.34.0
+	golang.org/x/time v0.11.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
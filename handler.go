@@ -3,18 +3,32 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 
-	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esapi"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/rs/zerolog"
 )
 
 type ElasticsearchHandler struct {
-	client *elasticsearch.Client
-	logger zerolog.Logger
+	clusters       map[string]*cluster
+	clusterNames   []string
+	defaultCluster string
+	policy         *searchPolicy
+	indexAccess    *indexAccess
+	redactor       *redactor
+	budgets        QueryBudgetConfig
+	cursors        *cursorStore
+	esql           ESQLConfig
+	sql            SQLConfig
+	sqlCursors     *sqlCursorStore
+	async          AsyncConfig
+	asyncTasks     *asyncTaskStore
+	semantic       SemanticConfig
+	logger         zerolog.Logger
 }
 
 type IndexInfo struct {
@@ -33,10 +47,12 @@ type IndexInfo struct {
 }
 
 type SearchResponse struct {
-	Took     int            `json:"took"`
-	TimedOut bool           `json:"timed_out"`
-	Shards   map[string]any `json:"_shards"`
-	Hits     struct {
+	Took            int            `json:"took"`
+	TimedOut        bool           `json:"timed_out"`
+	TerminatedEarly bool           `json:"terminated_early"`
+	PitID           string         `json:"pit_id,omitempty"`
+	Shards          map[string]any `json:"_shards"`
+	Hits            struct {
 		Total struct {
 			Value    int    `json:"value"`
 			Relation string `json:"relation"`
@@ -45,96 +61,137 @@ type SearchResponse struct {
 		Hits     []map[string]any `json:"hits"`
 	} `json:"hits"`
 	Aggregations map[string]any `json:"aggregations,omitempty"`
+	Profile      *SearchProfile `json:"profile,omitempty"`
 }
 
-func newElasticsearchHandler(
-	cfg ElasticsearchConfig,
-	logger zerolog.Logger,
-) (*ElasticsearchHandler, error) {
+func newElasticsearchHandler(config *Config, logger zerolog.Logger) (*ElasticsearchHandler, error) {
 	log := logger.With().Str("component", "elasticsearch").Logger()
 
-	log.Info().Str("url", cfg.URL).Msg("Creating Elasticsearch client")
-
-	// Configure Elasticsearch client
-	esCfg := elasticsearch.Config{
-		Addresses: []string{cfg.URL},
-	}
-
-	// Set authentication method
-	if cfg.APIKey != "" {
-		esCfg.APIKey = cfg.APIKey
-		log.Info().Msg("Using API key authentication")
-	} else if cfg.Username != "" && cfg.Password != "" {
-		esCfg.Username = cfg.Username
-		esCfg.Password = cfg.Password
-		log.Info().Str("username", cfg.Username).Msg("Using basic authentication")
-	}
-
-	client, err := elasticsearch.NewClient(esCfg)
+	redactor, err := newRedactor(config.Redaction)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to create Elasticsearch client")
-		return nil, fmt.Errorf("error creating elasticsearch client: %w", err)
-	}
+		return nil, err
+	}
+
+	defaultCluster := config.DefaultCluster
+	h := &ElasticsearchHandler{
+		clusters:       make(map[string]*cluster, len(config.Clusters)),
+		defaultCluster: defaultCluster,
+		policy:         newSearchPolicy(config.SearchPolicy),
+		indexAccess:    newIndexAccess(config.IndexAccess),
+		redactor:       redactor,
+		budgets:        config.QueryBudget,
+		cursors:        newCursorStore(config.Pagination),
+		esql:           config.ESQL,
+		sql:            config.SQL,
+		sqlCursors:     newSQLCursorStore(config.Pagination),
+		async:          config.Async,
+		asyncTasks:     newAsyncTaskStore(config.Async),
+		semantic:       config.Semantic,
+		logger:         log,
+	}
+
+	for _, cfg := range config.Clusters {
+		c, err := newCluster(cfg, log)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %q: %w", cfg.Name, err)
+		}
 
-	// Test connection
-	log.Debug().Msg("Testing Elasticsearch connection")
-	res, err := client.Info()
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to connect to Elasticsearch")
-		return nil, fmt.Errorf("error connecting to elasticsearch: %w", err)
-	}
-	defer res.Body.Close()
+		// Test connection. Only the default cluster is required to be
+		// reachable at startup; list_clusters reports the others.
+		if err := c.ping(context.Background()); err != nil {
+			if cfg.Name == defaultCluster {
+				log.Error().Err(err).Str("cluster", cfg.Name).Msg("Failed to connect to Elasticsearch")
+				return nil, fmt.Errorf("cluster %q: %w", cfg.Name, err)
+			}
+			log.Warn().Err(err).Str("cluster", cfg.Name).Msg("Elasticsearch cluster is not reachable")
+		} else {
+			log.Info().Str("cluster", cfg.Name).Msg("Elasticsearch connection successful")
+		}
 
-	if res.IsError() {
-		log.Error().Str("response", res.String()).Msg("Elasticsearch connection error")
-		return nil, fmt.Errorf("elasticsearch connection error: %s", res.String())
+		h.clusters[cfg.Name] = c
+		h.clusterNames = append(h.clusterNames, cfg.Name)
 	}
 
-	log.Info().Msg("Elasticsearch connection successful")
+	return h, nil
+}
 
-	return &ElasticsearchHandler{
-		client: client,
-		logger: log,
-	}, nil
+// requestLogger returns the handler logger annotated with the identity of the
+// client that issued the tool call.
+func (h *ElasticsearchHandler) requestLogger(ctx context.Context) zerolog.Logger {
+	return h.logger.With().Str("client_id", clientIdentityFromContext(ctx).ID).Logger()
 }
 
 func (h *ElasticsearchHandler) handleListIndices(
 	ctx context.Context,
 	request mcp.CallToolRequest,
 ) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+
+	c, err := h.clusterFor(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, _, err := h.queryBudget(ctx, "list_indices", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
 	pattern := request.GetString("pattern", "*")
 
-	h.logger.Info().Str("pattern", pattern).Msg("Listing indices")
+	log.Info().Str("pattern", pattern).Msg("Listing indices")
+
+	// Wildcards are not rejected here: the listing is filtered instead so
+	// that hidden indices simply do not show up.
+	if err := h.indexAccess.checkLiterals(pattern); err != nil {
+		log.Warn().Str("pattern", pattern).Msg("Index access denied")
+		return mcp.NewToolResultError(err.Error()), nil
+	}
 
 	// Use _cat/indices API for detailed index information
-	res, err := h.client.Cat.Indices(
-		h.client.Cat.Indices.WithContext(ctx),
-		h.client.Cat.Indices.WithIndex(pattern),
-		h.client.Cat.Indices.WithFormat("json"),
-		h.client.Cat.Indices.WithH(
+	res, err := c.client.Cat.Indices(
+		c.client.Cat.Indices.WithContext(ctx),
+		c.client.Cat.Indices.WithIndex(pattern),
+		c.client.Cat.Indices.WithFormat("json"),
+		c.client.Cat.Indices.WithH(
 			"index,health,status,uuid,docs.count,docs.deleted,store.size,pri.store.size,pri,rep,creation.date,creation.date.string",
 		),
 	)
 	if err != nil {
-		h.logger.Error().Err(err).Str("pattern", pattern).Msg("Failed to list indices")
+		log.Error().Err(err).Str("pattern", pattern).Msg("Failed to list indices")
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to list indices: %v", err)), nil
 	}
 	defer res.Body.Close()
 
 	if res.IsError() {
-		h.logger.Error().Str("response", res.String()).Msg("Elasticsearch error listing indices")
+		log.Error().Str("response", res.String()).Msg("Elasticsearch error listing indices")
 		return mcp.NewToolResultError(fmt.Sprintf("Elasticsearch error: %s", res.String())), nil
 	}
 
 	var indices []IndexInfo
 	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
-		h.logger.Error().Err(err).Msg("Failed to decode indices response")
+		log.Error().Err(err).Msg("Failed to decode indices response")
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to decode response: %v", err)), nil
 	}
 
+	// Backing indices are listed when their data stream is permitted, as
+	// the other tools judge them.
+	var dataStreams map[string]string
+	if h.indexAccess.enabled() {
+		if dataStreams, err = c.dataStreams(ctx, pattern); err != nil {
+			log.Error().Err(err).Str("pattern", pattern).Msg("Failed to resolve data streams")
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to list indices: %v", err)), nil
+		}
+	}
+
 	// Convert to a more readable format
 	var result []map[string]any
 	for _, idx := range indices {
+		if !h.indexAccess.permitted(accessName(idx.Name, dataStreams[idx.Name])) {
+			continue
+		}
 		result = append(result, map[string]any{
 			"name":          idx.Name,
 			"health":        idx.Health,
@@ -152,6 +209,7 @@ func (h *ElasticsearchHandler) handleListIndices(
 	}
 
 	response := map[string]any{
+		"cluster":       c.name,
 		"total_indices": len(result),
 		"pattern":       pattern,
 		"indices":       result,
@@ -159,11 +217,11 @@ func (h *ElasticsearchHandler) handleListIndices(
 
 	jsonBytes, err := json.Marshal(response)
 	if err != nil {
-		h.logger.Error().Err(err).Msg("Failed to marshal indices response")
+		log.Error().Err(err).Msg("Failed to marshal indices response")
 		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
 	}
 
-	h.logger.Info().
+	log.Info().
 		Int("count", len(result)).
 		Str("pattern", pattern).
 		Msg("Listed indices successfully")
@@ -174,47 +232,66 @@ func (h *ElasticsearchHandler) handleGetMappings(
 	ctx context.Context,
 	request mcp.CallToolRequest,
 ) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+
 	index, err := request.RequireString("index")
 	if err != nil {
-		h.logger.Error().Err(err).Msg("Missing index parameter")
+		log.Error().Err(err).Msg("Missing index parameter")
 		return mcp.NewToolResultError("Missing 'index' parameter"), nil
 	}
 
-	h.logger.Info().Str("index", index).Msg("Getting index mappings")
+	c, err := h.clusterFor(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, _, err := h.queryBudget(ctx, "get_index_mappings", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
 
-	res, err := h.client.Indices.GetMapping(
-		h.client.Indices.GetMapping.WithContext(ctx),
-		h.client.Indices.GetMapping.WithIndex(index),
+	log.Info().Str("index", index).Msg("Getting index mappings")
+
+	if result := h.checkIndexAccess(ctx, log, c, index); result != nil {
+		return result, nil
+	}
+
+	res, err := c.client.Indices.GetMapping(
+		c.client.Indices.GetMapping.WithContext(ctx),
+		c.client.Indices.GetMapping.WithIndex(index),
 	)
 	if err != nil {
-		h.logger.Error().Err(err).Str("index", index).Msg("Failed to get mappings")
+		log.Error().Err(err).Str("index", index).Msg("Failed to get mappings")
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to get mappings: %v", err)), nil
 	}
 	defer res.Body.Close()
 
 	if res.IsError() {
-		h.logger.Error().Str("response", res.String()).Msg("Elasticsearch error getting mappings")
+		log.Error().Str("response", res.String()).Msg("Elasticsearch error getting mappings")
 		return mcp.NewToolResultError(fmt.Sprintf("Elasticsearch error: %s", res.String())), nil
 	}
 
 	var mappings map[string]any
 	if err := json.NewDecoder(res.Body).Decode(&mappings); err != nil {
-		h.logger.Error().Err(err).Msg("Failed to decode mappings response")
+		log.Error().Err(err).Msg("Failed to decode mappings response")
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to decode response: %v", err)), nil
 	}
 
 	response := map[string]any{
+		"cluster":  c.name,
 		"index":    index,
 		"mappings": mappings,
 	}
 
 	jsonBytes, err := json.Marshal(response)
 	if err != nil {
-		h.logger.Error().Err(err).Msg("Failed to marshal mappings response")
+		log.Error().Err(err).Msg("Failed to marshal mappings response")
 		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
 	}
 
-	h.logger.Info().Str("index", index).Msg("Retrieved mappings successfully")
+	log.Info().Str("index", index).Msg("Retrieved mappings successfully")
 	return mcp.NewToolResultText(string(jsonBytes)), nil
 }
 
@@ -222,12 +299,30 @@ func (h *ElasticsearchHandler) handleSearch(
 	ctx context.Context,
 	request mcp.CallToolRequest,
 ) (*mcp.CallToolResult, error) {
+	if cursor := request.GetString("cursor", ""); cursor != "" {
+		return h.handleSearchPage(ctx, request, cursor)
+	}
+
+	log := h.requestLogger(ctx)
+
 	index, err := request.RequireString("index")
 	if err != nil {
-		h.logger.Error().Err(err).Msg("Missing index parameter")
+		log.Error().Err(err).Msg("Missing index parameter")
 		return mcp.NewToolResultError("Missing 'index' parameter"), nil
 	}
 
+	c, err := h.clusterFor(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, budget, err := h.queryBudget(ctx, "search", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
 	queryString := request.GetString("query", "{}")
 	size := request.GetInt("size", 10)
 	from := request.GetInt("from", 0)
@@ -236,8 +331,10 @@ func (h *ElasticsearchHandler) handleSearch(
 	sourceString := request.GetString("_source", "")
 	highlightString := request.GetString("highlight", "")
 	trackTotalHits := request.GetBool("track_total_hits", true)
+	paginate := request.GetBool("paginate", false)
+	profile := request.GetBool("profile", false)
 
-	h.logger.Info().
+	log.Info().
 		Str("index", index).
 		Str("query", queryString).
 		Int("size", size).
@@ -247,6 +344,8 @@ func (h *ElasticsearchHandler) handleSearch(
 		Str("_source", sourceString).
 		Str("highlight", highlightString).
 		Bool("track_total_hits", trackTotalHits).
+		Bool("paginate", paginate).
+		Bool("profile", profile).
 		Msg("Executing search")
 
 	// Validate size and from parameters
@@ -259,26 +358,21 @@ func (h *ElasticsearchHandler) handleSearch(
 	if from+size > 10000 {
 		return mcp.NewToolResultError("from + size must not exceed 10000"), nil
 	}
+	if paginate && from > 0 {
+		return mcp.NewToolResultError("from cannot be used with paginate; follow the returned cursor instead"), nil
+	}
+	if paginate && size == 0 {
+		return mcp.NewToolResultError("size must be greater than 0 with paginate"), nil
+	}
+	if paginate && profile {
+		return mcp.NewToolResultError("profile cannot be used with paginate"), nil
+	}
 
 	// Parse query JSON
-	var query map[string]any
-	if queryString == "{}" || queryString == "" {
-		// Default to match_all query if empty
-		query = map[string]any{
-			"match_all": map[string]any{},
-		}
-	} else {
-		if err := json.Unmarshal([]byte(queryString), &query); err != nil {
-			h.logger.Error().Err(err).Str("query", queryString).Msg("Invalid query JSON")
-			return mcp.NewToolResultError(fmt.Sprintf("Invalid query JSON: %v", err)), nil
-		}
-
-		// Validate that query is not empty after parsing
-		if len(query) == 0 {
-			query = map[string]any{
-				"match_all": map[string]any{},
-			}
-		}
+	query, err := parseQuery(queryString)
+	if err != nil {
+		log.Error().Err(err).Str("query", queryString).Msg("Invalid query JSON")
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid query JSON: %v", err)), nil
 	}
 
 	// Build search request
@@ -292,11 +386,15 @@ func (h *ElasticsearchHandler) handleSearch(
 		searchRequest["track_total_hits"] = true
 	}
 
+	if profile {
+		searchRequest["profile"] = true
+	}
+
 	// Parse and add sort if provided
 	if sortString != "" {
 		var sort any
 		if err := json.Unmarshal([]byte(sortString), &sort); err != nil {
-			h.logger.Error().Err(err).Str("sort", sortString).Msg("Invalid sort JSON")
+			log.Error().Err(err).Str("sort", sortString).Msg("Invalid sort JSON")
 			return mcp.NewToolResultError(fmt.Sprintf("Invalid sort JSON: %v", err)), nil
 		}
 		searchRequest["sort"] = sort
@@ -306,7 +404,7 @@ func (h *ElasticsearchHandler) handleSearch(
 	if aggsString != "" {
 		var aggs map[string]any
 		if err := json.Unmarshal([]byte(aggsString), &aggs); err != nil {
-			h.logger.Error().Err(err).Str("aggs", aggsString).Msg("Invalid aggregations JSON")
+			log.Error().Err(err).Str("aggs", aggsString).Msg("Invalid aggregations JSON")
 			return mcp.NewToolResultError(fmt.Sprintf("Invalid aggregations JSON: %v", err)), nil
 		}
 		searchRequest["aggs"] = aggs
@@ -316,7 +414,7 @@ func (h *ElasticsearchHandler) handleSearch(
 	if sourceString != "" {
 		var source any
 		if err := json.Unmarshal([]byte(sourceString), &source); err != nil {
-			h.logger.Error().Err(err).Str("_source", sourceString).Msg("Invalid _source JSON")
+			log.Error().Err(err).Str("_source", sourceString).Msg("Invalid _source JSON")
 			return mcp.NewToolResultError(fmt.Sprintf("Invalid _source JSON: %v", err)), nil
 		}
 		searchRequest["_source"] = source
@@ -326,7 +424,7 @@ func (h *ElasticsearchHandler) handleSearch(
 	if highlightString != "" {
 		var highlight map[string]any
 		if err := json.Unmarshal([]byte(highlightString), &highlight); err != nil {
-			h.logger.Error().
+			log.Error().
 				Err(err).
 				Str("highlight", highlightString).
 				Msg("Invalid highlight JSON")
@@ -335,72 +433,71 @@ func (h *ElasticsearchHandler) handleSearch(
 		searchRequest["highlight"] = highlight
 	}
 
-	// Convert to JSON
-	searchBody, err := json.Marshal(searchRequest)
-	if err != nil {
-		h.logger.Error().Err(err).Msg("Failed to marshal search request")
-		return mcp.NewToolResultError("Failed to create search request"), nil
+	if result := h.checkIndexAccess(ctx, log, c, index); result != nil {
+		return result, nil
 	}
 
-	h.logger.Debug().RawJSON("search_body", searchBody).Msg("Search request body")
-
-	searchOptions := []func(*esapi.SearchRequest){
-		h.client.Search.WithContext(ctx),
-		h.client.Search.WithIndex(index),
-		h.client.Search.WithBody(strings.NewReader(string(searchBody))),
-		h.client.Search.WithTrackTotalHits(trackTotalHits),
-		h.client.Search.WithPretty(),
+	if violation := h.policy.check(searchRequest); violation != nil {
+		log.Warn().
+			Str("index", index).
+			Str("rule", violation.Rule).
+			Str("path", violation.Path).
+			Msg("Search rejected by policy")
+		return violation.toolResult(), nil
 	}
 
-	// Execute search
-	res, err := h.client.Search(searchOptions...)
-	if err != nil {
-		h.logger.Error().Err(err).Str("index", index).Msg("Failed to execute search")
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to execute search: %v", err)), nil
+	var cursor *cursorState
+	if paginate {
+		if cursor, err = h.openCursor(ctx, c, index, searchRequest, size, trackTotalHits); err != nil {
+			log.Error().Err(err).Str("index", index).Msg("Failed to open point in time")
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to open point in time: %v", err)), nil
+		}
+		searchRequest = cursor.body()
 	}
-	defer res.Body.Close()
 
-	if res.IsError() {
-		h.logger.Error().Str("response", res.String()).Msg("Elasticsearch search error")
-		return mcp.NewToolResultError(
-			fmt.Sprintf("Elasticsearch search error: %s", res.String()),
-		), nil
+	searchIndex := index
+	if cursor != nil {
+		// Point in time searches target the indices the PIT was opened on.
+		searchIndex = ""
+	}
+	searchResponse, errResult := h.executeSearch(ctx, log, c, searchIndex, searchRequest, budget, trackTotalHits)
+	if errResult != nil {
+		if cursor != nil {
+			h.closeCursor(c, cursor)
+		}
+		return errResult, nil
 	}
 
-	var searchResponse SearchResponse
-	if err := json.NewDecoder(res.Body).Decode(&searchResponse); err != nil {
-		h.logger.Error().Err(err).Msg("Failed to decode search response")
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to decode response: %v", err)), nil
+	searchAfter := lastSort(searchResponse)
+	if errResult := h.redactSearchResponse(ctx, log, c, searchResponse, searchRequest); errResult != nil {
+		if cursor != nil {
+			h.closeCursor(c, cursor)
+		}
+		return errResult, nil
 	}
 
 	// Build response with metadata
-	response := map[string]any{
-		"index":      index,
-		"took":       searchResponse.Took,
-		"timed_out":  searchResponse.TimedOut,
-		"total_hits": searchResponse.Hits.Total.Value,
-		"max_score":  searchResponse.Hits.MaxScore,
-		"hits":       searchResponse.Hits.Hits,
-		"shards":     searchResponse.Shards,
-		"from":       from,
-		"size":       size,
+	response := searchResult(c, index, searchResponse, budget)
+	response["from"] = from
+	response["size"] = size
+
+	// The raw profile tree is too verbose to be useful; send a condensed
+	// breakdown instead.
+	if profile {
+		response["profile"] = summarizeProfile(searchResponse.Profile)
 	}
 
-	// Add aggregations to response if present
-	if searchResponse.Aggregations != nil && len(searchResponse.Aggregations) > 0 {
-		response["aggregations"] = searchResponse.Aggregations
-		h.logger.Debug().
-			Int("agg_count", len(searchResponse.Aggregations)).
-			Msg("Aggregations found in response")
+	if cursor != nil {
+		h.advanceCursor(log, c, cursor, searchResponse, searchAfter, response)
 	}
 
 	jsonBytes, err := json.Marshal(response)
 	if err != nil {
-		h.logger.Error().Err(err).Msg("Failed to marshal search response")
+		log.Error().Err(err).Msg("Failed to marshal search response")
 		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
 	}
 
-	h.logger.Info().
+	log.Info().
 		Str("index", index).
 		Int("total_hits", searchResponse.Hits.Total.Value).
 		Int("returned_hits", len(searchResponse.Hits.Hits)).
@@ -410,3 +507,122 @@ func (h *ElasticsearchHandler) handleSearch(
 
 	return mcp.NewToolResultText(string(jsonBytes)), nil
 }
+
+// parseQuery parses a query DSL argument, defaulting to match_all when it is
+// empty.
+func parseQuery(queryString string) (map[string]any, error) {
+	var query map[string]any
+	if queryString != "{}" && queryString != "" {
+		if err := json.Unmarshal([]byte(queryString), &query); err != nil {
+			return nil, err
+		}
+	}
+
+	// Default to match_all query if empty
+	if len(query) == 0 {
+		query = map[string]any{
+			"match_all": map[string]any{},
+		}
+	}
+	return query, nil
+}
+
+// executeSearch runs a search body against index, or against the point in
+// time named in the body when index is empty, within the call's budget. On
+// failure it returns the tool error to send back.
+func (h *ElasticsearchHandler) executeSearch(
+	ctx context.Context,
+	log zerolog.Logger,
+	c *cluster,
+	index string,
+	body map[string]any,
+	budget queryBudget,
+	trackTotalHits bool,
+) (*SearchResponse, *mcp.CallToolResult) {
+	auditRequest(ctx, index, body)
+
+	// Convert to JSON
+	searchBody, err := json.Marshal(body)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal search request")
+		return nil, mcp.NewToolResultError("Failed to create search request")
+	}
+
+	log.Debug().RawJSON("search_body", searchBody).Msg("Search request body")
+
+	searchOptions := []func(*esapi.SearchRequest){
+		c.client.Search.WithContext(ctx),
+		c.client.Search.WithBody(strings.NewReader(string(searchBody))),
+		c.client.Search.WithTrackTotalHits(trackTotalHits),
+		c.client.Search.WithPretty(),
+	}
+	if index != "" {
+		searchOptions = append(searchOptions, c.client.Search.WithIndex(index))
+	}
+	if budget.Timeout > 0 {
+		searchOptions = append(searchOptions, c.client.Search.WithTimeout(budget.Timeout))
+	}
+	if budget.TerminateAfter > 0 {
+		searchOptions = append(searchOptions, c.client.Search.WithTerminateAfter(budget.TerminateAfter))
+	}
+
+	// Execute search
+	res, err := c.client.Search(searchOptions...)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Warn().Str("index", index).Dur("timeout", budget.Timeout).Msg("Search deadline exceeded")
+			return nil, mcp.NewToolResultError(fmt.Sprintf(
+				"Search did not complete within its %s timeout; narrow the query or ask for a shorter timeout to get partial results",
+				budget.Timeout,
+			))
+		}
+		log.Error().Err(err).Str("index", index).Msg("Failed to execute search")
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Failed to execute search: %v", err))
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		log.Error().Str("response", res.String()).Msg("Elasticsearch search error")
+		if res.StatusCode == http.StatusBadRequest {
+			return nil, mcp.NewToolResultError(fmt.Sprintf(
+				"Elasticsearch search error: %s\nCheck the query with the validate_query tool before retrying.",
+				res.String(),
+			))
+		}
+		return nil, mcp.NewToolResultError(
+			fmt.Sprintf("Elasticsearch search error: %s", res.String()),
+		)
+	}
+
+	var searchResponse SearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&searchResponse); err != nil {
+		log.Error().Err(err).Msg("Failed to decode search response")
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Failed to decode response: %v", err))
+	}
+
+	return &searchResponse, nil
+}
+
+// searchResult builds the tool response of a search.
+func searchResult(c *cluster, index string, searchResponse *SearchResponse, budget queryBudget) map[string]any {
+	response := map[string]any{
+		"cluster":          c.name,
+		"index":            index,
+		"took":             searchResponse.Took,
+		"timed_out":        searchResponse.TimedOut,
+		"terminated_early": searchResponse.TerminatedEarly,
+		"partial":          searchResponse.TimedOut || searchResponse.TerminatedEarly,
+		"budget":           budget.response(),
+		"total_hits":       searchResponse.Hits.Total.Value,
+		"max_score":        searchResponse.Hits.MaxScore,
+		"hits":             searchResponse.Hits.Hits,
+		"shards":           searchResponse.Shards,
+	}
+
+	// Add aggregations to response if present
+	if len(searchResponse.Aggregations) > 0 {
+		response["aggregations"] = searchResponse.Aggregations
+	}
+
+	return response
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Ways of combining a kNN search with a lexical query.
+const (
+	combineRRF      = "rrf"
+	combineWeighted = "weighted"
+)
+
+// maxKNNCandidates is the largest k and num_candidates Elasticsearch accepts.
+const maxKNNCandidates = 10000
+
+// fieldMappings returns the mapping of field in every index of the
+// expression that maps it, keyed by index name.
+func (c *cluster) fieldMappings(ctx context.Context, index, field string) (map[string]map[string]any, error) {
+	res, err := c.client.Indices.GetFieldMapping(
+		[]string{field},
+		c.client.Indices.GetFieldMapping.WithContext(ctx),
+		c.client.Indices.GetFieldMapping.WithIndex(index),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var response map[string]struct {
+		Mappings map[string]struct {
+			Mapping map[string]map[string]any `json:"mapping"`
+		} `json:"mappings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	mappings := make(map[string]map[string]any)
+	for name, indexMappings := range response {
+		// The mapping is keyed by the last part of the field name.
+		for _, mapping := range indexMappings.Mappings[field].Mapping {
+			mappings[name] = mapping
+		}
+	}
+	return mappings, nil
+}
+
+// checkVectorField checks that field is a dense_vector field with dims
+// dimensions in every index of the expression that maps it.
+func (c *cluster) checkVectorField(ctx context.Context, index, field string, dims int) error {
+	mappings, err := c.fieldMappings(ctx, index, field)
+	if err != nil {
+		return err
+	}
+	if len(mappings) == 0 {
+		return fmt.Errorf("field %q is not mapped in %q", field, index)
+	}
+
+	for _, name := range sortedKeys(mappings) {
+		mapping := mappings[name]
+		if fieldType, _ := mapping["type"].(string); fieldType != "dense_vector" {
+			return fmt.Errorf("field %q of index %q is a %s field, not a dense_vector field", field, name, fieldType)
+		}
+		// Vector fields whose dimensions are not set yet take those of the
+		// first vector indexed.
+		if mapped, ok := mapping["dims"].(float64); ok && int(mapped) != dims {
+			return fmt.Errorf(
+				"query_vector has %d dimensions but field %q of index %q has %d",
+				dims, field, name, int(mapped),
+			)
+		}
+	}
+	return nil
+}
+
+func (h *ElasticsearchHandler) handleKNNSearch(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+
+	index, err := request.RequireString("index")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing index parameter")
+		return mcp.NewToolResultError("Missing 'index' parameter"), nil
+	}
+	field, err := request.RequireString("field")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing field parameter")
+		return mcp.NewToolResultError("Missing 'field' parameter"), nil
+	}
+	vectorString, err := request.RequireString("query_vector")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing query_vector parameter")
+		return mcp.NewToolResultError("Missing 'query_vector' parameter"), nil
+	}
+
+	c, err := h.clusterFor(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, budget, err := h.queryBudget(ctx, "knn_search", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
+	var vector []float64
+	if err := json.Unmarshal([]byte(vectorString), &vector); err != nil || len(vector) == 0 {
+		return mcp.NewToolResultError("query_vector must be a JSON array of numbers"), nil
+	}
+
+	knn, err := knnSection(request, field, vector)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	k := knn["k"].(int)
+
+	size := request.GetInt("size", k)
+	if size < 0 || size > 10000 {
+		return mcp.NewToolResultError("Size parameter must be between 0 and 10000"), nil
+	}
+
+	queryString := request.GetString("query", "")
+
+	log.Info().
+		Str("index", index).
+		Str("field", field).
+		Int("dims", len(vector)).
+		Int("k", k).
+		Str("query", queryString).
+		Msg("Executing kNN search")
+
+	// The policy only inspects a body's top-level query, so the filter and
+	// the lexical query are checked on their own: with RRF the query sits in
+	// a retriever.
+	var filter, query map[string]any
+	if filterString := request.GetString("filter", ""); filterString != "" {
+		if err := json.Unmarshal([]byte(filterString), &filter); err != nil {
+			log.Error().Err(err).Str("filter", filterString).Msg("Invalid filter JSON")
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid filter JSON: %v", err)), nil
+		}
+		knn["filter"] = filter
+	}
+	if queryString != "" {
+		if err := json.Unmarshal([]byte(queryString), &query); err != nil {
+			log.Error().Err(err).Str("query", queryString).Msg("Invalid query JSON")
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid query JSON: %v", err)), nil
+		}
+	}
+	for _, part := range []map[string]any{filter, query} {
+		if part == nil {
+			continue
+		}
+		if violation := h.policy.check(map[string]any{"query": part}); violation != nil {
+			log.Warn().
+				Str("index", index).
+				Str("rule", violation.Rule).
+				Str("path", violation.Path).
+				Msg("kNN search rejected by policy")
+			return violation.toolResult(), nil
+		}
+	}
+
+	searchRequest, mode, err := knnSearchBody(request, knn, query, size)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if sourceString := request.GetString("_source", ""); sourceString != "" {
+		var source any
+		if err := json.Unmarshal([]byte(sourceString), &source); err != nil {
+			log.Error().Err(err).Str("_source", sourceString).Msg("Invalid _source JSON")
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid _source JSON: %v", err)), nil
+		}
+		searchRequest["_source"] = source
+	} else {
+		// Vectors are long and mean nothing to the caller.
+		searchRequest["_source"] = map[string]any{"excludes": []string{field}}
+	}
+
+	if result := h.checkIndexAccess(ctx, log, c, index); result != nil {
+		return result, nil
+	}
+
+	if err := c.checkVectorField(ctx, index, field, len(vector)); err != nil {
+		log.Warn().Err(err).Str("index", index).Str("field", field).Msg("Invalid vector field")
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	searchResponse, errResult := h.executeSearch(ctx, log, c, index, searchRequest, budget, true)
+	if errResult != nil {
+		return errResult, nil
+	}
+
+	if errResult := h.redactSearchResponse(ctx, log, c, searchResponse, searchRequest); errResult != nil {
+		return errResult, nil
+	}
+
+	response := searchResult(c, index, searchResponse, budget)
+	response["mode"] = mode
+	response["k"] = k
+	response["size"] = size
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal kNN search response")
+		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+	}
+
+	log.Info().
+		Str("index", index).
+		Str("mode", mode).
+		Int("returned_hits", len(searchResponse.Hits.Hits)).
+		Int("took_ms", searchResponse.Took).
+		Msg("kNN search executed successfully")
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
+
+// knnSection builds the kNN part of the search from the call's arguments.
+func knnSection(request mcp.CallToolRequest, field string, vector []float64) (map[string]any, error) {
+	k := request.GetInt("k", 10)
+	if k <= 0 || k > maxKNNCandidates {
+		return nil, fmt.Errorf("k must be between 1 and %d", maxKNNCandidates)
+	}
+	numCandidates := request.GetInt("num_candidates", min(max(k*10, 100), maxKNNCandidates))
+	if numCandidates < k || numCandidates > maxKNNCandidates {
+		return nil, fmt.Errorf("num_candidates must be between k and %d", maxKNNCandidates)
+	}
+
+	knn := map[string]any{
+		"field":          field,
+		"query_vector":   vector,
+		"k":              k,
+		"num_candidates": numCandidates,
+	}
+	if similarity := request.GetFloat("similarity", 0); similarity != 0 {
+		knn["similarity"] = similarity
+	}
+	return knn, nil
+}
+
+// knnSearchBody builds the search body: the kNN search alone, or combined
+// with a lexical query by reciprocal rank fusion or by adding up their
+// weighted scores. It returns the body and how the searches are combined.
+func knnSearchBody(
+	request mcp.CallToolRequest,
+	knn map[string]any,
+	query map[string]any,
+	size int,
+) (map[string]any, string, error) {
+	if query == nil {
+		return map[string]any{"knn": knn, "size": size}, "knn", nil
+	}
+
+	// The filter narrows the lexical matches as well as the nearest
+	// neighbours.
+	if filter, ok := knn["filter"]; ok {
+		query = map[string]any{"bool": map[string]any{"must": query, "filter": filter}}
+	}
+
+	switch combination := request.GetString("combination", combineRRF); combination {
+	case combineRRF:
+		rrf := map[string]any{
+			"retrievers": []any{
+				map[string]any{"standard": map[string]any{"query": query}},
+				map[string]any{"knn": knn},
+			},
+		}
+		if windowSize := request.GetInt("rank_window_size", 0); windowSize > 0 {
+			if windowSize < size {
+				return nil, "", errors.New("rank_window_size must not be smaller than size")
+			}
+			rrf["rank_window_size"] = windowSize
+		}
+		if rankConstant := request.GetInt("rank_constant", 0); rankConstant > 0 {
+			rrf["rank_constant"] = rankConstant
+		}
+		return map[string]any{"retriever": map[string]any{"rrf": rrf}, "size": size}, combineRRF, nil
+
+	case combineWeighted:
+		queryWeight := request.GetFloat("query_weight", 1)
+		knnWeight := request.GetFloat("knn_weight", 1)
+		if queryWeight < 0 || knnWeight < 0 {
+			return nil, "", errors.New("query_weight and knn_weight must not be negative")
+		}
+		knn["boost"] = knnWeight
+		return map[string]any{
+			"query": map[string]any{"bool": map[string]any{"must": query, "boost": queryWeight}},
+			"knn":   knn,
+			"size":  size,
+		}, combineWeighted, nil
+
+	default:
+		return nil, "", fmt.Errorf("invalid combination %q, expected %q or %q", combination, combineRRF, combineWeighted)
+	}
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
@@ -10,6 +15,30 @@ import (
 
 var version = "dev"
 
+// toolNames lists the tools the server registers, which per tool rate limits
+// refer to.
+var toolNames = []string{
+	"list_clusters",
+	"list_indices",
+	"get_index_mappings",
+	"search",
+	"count",
+	"esql",
+	"sql",
+	"eql_search",
+	"msearch",
+	"async_search_submit",
+	"async_search_get",
+	"async_search_delete",
+	"validate_query",
+	"explain_document",
+	"knn_search",
+	"semantic_search",
+	"list_search_templates",
+	"render_search_template",
+	"search_template",
+}
+
 func main() {
 	if err := run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -18,11 +47,23 @@ func main() {
 }
 
 func run() error {
-	cfg, err := loadConfig()
+	flags, err := parseFlags(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	cfg, err := loadConfig(flags)
 	if err != nil {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
 
+	if flags.PrintConfig {
+		return printConfig(os.Stdout, cfg)
+	}
+
 	if version != "dev" {
 		cfg.Server.Version = version
 	}
@@ -36,22 +77,67 @@ func run() error {
 		Str("server_name", cfg.Server.Name).
 		Str("version", cfg.Server.Version).
 		Str("log_level", cfg.Logging.Level).
-		Str("elasticsearch_url", cfg.Elasticsearch.URL).
-		Bool("use_api_key", cfg.Elasticsearch.APIKey != "").
-		Bool("use_basic_auth", cfg.Elasticsearch.Username != "").
+		Str("transport", cfg.Server.Transport).
+		Str("auth_mode", cfg.Auth.Mode).
+		Int("clusters", len(cfg.Clusters)).
+		Str("default_cluster", cfg.DefaultCluster).
 		Msg("Configuration loaded")
 
+	for _, clusterCfg := range cfg.Clusters {
+		log.Info().
+			Str("cluster", clusterCfg.Name).
+			Str("elasticsearch_endpoint", clusterCfg.endpoint()).
+			Str("auth", clusterCfg.authMethod()).
+			Msg("Cluster configured")
+	}
+
+	auth, err := newAuthenticator(cfg.Auth)
+	if err != nil {
+		return fmt.Errorf("failed to initialize authenticator: %w", err)
+	}
+	if auth == nil && cfg.Server.Transport != transportStdio {
+		log.Warn().Msg("HTTP transport enabled without authentication (MCP_ES_AUTH_MODE=none)")
+	}
+
 	// Initialize Elasticsearch client and handler
-	esHandler, err := newElasticsearchHandler(cfg.Elasticsearch, log)
+	esHandler, err := newElasticsearchHandler(cfg, log)
 	if err != nil {
 		return fmt.Errorf("failed to initialize Elasticsearch handler: %w", err)
 	}
 
+	serverOptions := []server.ServerOption{server.WithToolCapabilities(false)}
+
+	if cfg.Audit.Enabled {
+		audit, err := newAuditLogger(cfg.Audit, cfg.DefaultCluster)
+		if err != nil {
+			return fmt.Errorf("failed to initialize audit log: %w", err)
+		}
+		defer audit.Close()
+
+		serverOptions = append(serverOptions, server.WithToolHandlerMiddleware(audit.middleware))
+		log.Info().Str("output", cfg.Audit.Output).Msg("Audit log enabled")
+	}
+
+	if cfg.RateLimit.enabled() {
+		limiter := newRateLimiter(cfg.RateLimit, log)
+		serverOptions = append(serverOptions, server.WithToolHandlerMiddleware(limiter.middleware))
+		log.Info().Msg("Rate limiting enabled")
+	}
+
 	// Create MCP server
-	s := server.NewMCPServer(
-		cfg.Server.Name,
-		cfg.Server.Version,
-		server.WithToolCapabilities(false),
+	s := server.NewMCPServer(cfg.Server.Name, cfg.Server.Version, serverOptions...)
+
+	clusterDescription := fmt.Sprintf(
+		"Name of the cluster to query (default: %q). Use list_clusters to see the available clusters.",
+		cfg.DefaultCluster,
+	)
+
+	// Add list_clusters tool
+	listClustersTool := mcp.NewTool(
+		"list_clusters",
+		mcp.WithDescription(
+			"List the configured Elasticsearch clusters with their name, version and reachability.",
+		),
 	)
 
 	// Add list_indices tool
@@ -64,6 +150,9 @@ func run() error {
 			mcp.DefaultString("*"),
 			mcp.Description("Index pattern filter (e.g., 'logs-*', 'apm-*')"),
 		),
+		mcp.WithString("cluster",
+			mcp.Description(clusterDescription),
+		),
 	)
 
 	// Add get_index_mappings tool
@@ -76,6 +165,9 @@ func run() error {
 			mcp.Required(),
 			mcp.Description("Index name or pattern (e.g., 'logs-*', 'apm-errors-*')"),
 		),
+		mcp.WithString("cluster",
+			mcp.Description(clusterDescription),
+		),
 	)
 
 	// Add search tool
@@ -86,7 +178,7 @@ func run() error {
 		),
 		mcp.WithString("index",
 			mcp.Required(),
-			mcp.Description("Index name or pattern to search"),
+			mcp.Description("Index name or pattern to search (ignored when 'cursor' is set)"),
 		),
 		mcp.WithString("query",
 			mcp.DefaultString("{}"),
@@ -131,16 +223,537 @@ func run() error {
 			mcp.DefaultBool(true),
 			mcp.Description("Whether to track the total number of hits"),
 		),
+		mcp.WithBoolean("paginate",
+			mcp.DefaultBool(false),
+			mcp.Description(
+				"Page through a large result set with a point in time and search_after. The response carries a 'cursor' to pass on the next call while 'has_more' is true.",
+			),
+		),
+		mcp.WithBoolean("profile",
+			mcp.DefaultBool(false),
+			mcp.Description(
+				"Profile the search to find out why it is slow. The response carries a condensed per-shard breakdown of query, collector, aggregation and fetch timings and the slowest components.",
+			),
+		),
+		mcp.WithString("cursor",
+			mcp.Description(
+				"Cursor returned by a previous paginated search. Fetches the next page of that search; all other parameters except timeout are ignored.",
+			),
+		),
+		mcp.WithString("timeout",
+			mcp.Description(
+				"Search timeout as a duration (e.g., '10s'). Results gathered before it expires are returned as partial results. Capped by the server's maximum.",
+			),
+		),
+		mcp.WithNumber("terminate_after",
+			mcp.Description(
+				"Maximum number of documents to collect per shard before terminating the search early. Capped by the server's maximum.",
+			),
+		),
+		mcp.WithString("cluster",
+			mcp.Description(clusterDescription),
+		),
+	)
+
+	// Add count tool
+	countTool := mcp.NewTool(
+		"count",
+		mcp.WithDescription(
+			"Count the documents matching a query without fetching them. When the index expression covers several indices, a per-index breakdown is returned next to the overall count.",
+		),
+		mcp.WithString("index",
+			mcp.Required(),
+			mcp.Description("Index name or pattern to count, or a comma-separated list of them (e.g., 'logs-*,metrics-*')"),
+		),
+		mcp.WithString("query",
+			mcp.DefaultString("{}"),
+			mcp.Description("Elasticsearch query DSL as JSON string"),
+		),
+		mcp.WithString("timeout",
+			mcp.Description(
+				"Count timeout as a duration (e.g., '10s'). Capped by the server's maximum.",
+			),
+		),
+		mcp.WithNumber("terminate_after",
+			mcp.Description(
+				"Maximum number of documents to count per shard before terminating early. Capped by the server's maximum.",
+			),
+		),
+		mcp.WithString("cluster",
+			mcp.Description(clusterDescription),
+		),
+	)
+
+	// Add kNN search tool
+	knnSearchTool := mcp.NewTool(
+		"knn_search",
+		mcp.WithDescription(
+			"Find the documents nearest to a query vector in a dense_vector field, optionally combined with a lexical query (hybrid search) by reciprocal rank fusion or weighted scores.",
+		),
+		mcp.WithString("index",
+			mcp.Required(),
+			mcp.Description("Index name or pattern to search"),
+		),
+		mcp.WithString("field",
+			mcp.Required(),
+			mcp.Description("dense_vector field holding the embeddings"),
+		),
+		mcp.WithString("query_vector",
+			mcp.Required(),
+			mcp.Description("Query vector as a JSON array of numbers; its length must match the field's dimensions"),
+		),
+		mcp.WithNumber("k",
+			mcp.DefaultNumber(10),
+			mcp.Description("Number of nearest neighbours to find"),
+		),
+		mcp.WithNumber("num_candidates",
+			mcp.Description("Candidates considered per shard; higher is more accurate but slower (default: 10 times k, at least 100)"),
+		),
+		mcp.WithNumber("similarity",
+			mcp.Description("Minimum similarity for a document to count as a neighbour"),
+		),
+		mcp.WithString("filter",
+			mcp.Description("Query DSL as JSON string restricting the documents searched (e.g., '{\"term\": {\"lang\": \"en\"}}')"),
+		),
+		mcp.WithString("query",
+			mcp.Description("Lexical query DSL as JSON string to combine with the kNN search"),
+		),
+		mcp.WithString("combination",
+			mcp.DefaultString(combineRRF),
+			mcp.Enum(combineRRF, combineWeighted),
+			mcp.Description(
+				"How to combine the kNN search with 'query': 'rrf' fuses the two rankings (Elasticsearch 8.14+), 'weighted' adds up their scores weighted by query_weight and knn_weight",
+			),
+		),
+		mcp.WithNumber("query_weight",
+			mcp.Description("Weight of the lexical query's score with 'weighted' (default: 1)"),
+		),
+		mcp.WithNumber("knn_weight",
+			mcp.Description("Weight of the kNN score with 'weighted' (default: 1)"),
+		),
+		mcp.WithNumber("rank_window_size",
+			mcp.Description("Number of results of each search fused with 'rrf' (default: size)"),
+		),
+		mcp.WithNumber("rank_constant",
+			mcp.Description("How much lower ranks contribute with 'rrf' (default: 60)"),
+		),
+		mcp.WithNumber("size",
+			mcp.Description("Maximum number of documents to return (default: k)"),
+		),
+		mcp.WithString("_source",
+			mcp.Description("Source filtering as JSON string; by default the source is returned without the vector field"),
+		),
+		mcp.WithString("timeout",
+			mcp.Description(
+				"Search timeout as a duration (e.g., '10s'). Capped by the server's maximum.",
+			),
+		),
+		mcp.WithString("cluster",
+			mcp.Description(clusterDescription),
+		),
+	)
+
+	// Add semantic search tool
+	semanticSearchTool := mcp.NewTool(
+		"semantic_search",
+		mcp.WithDescription(
+			"Search by meaning with plain text. The server picks the semantic_text, dense_vector, sparse_vector or rank_features field from the mapping and has Elasticsearch embed the text with an inference endpoint.",
+		),
+		mcp.WithString("index",
+			mcp.Required(),
+			mcp.Description("Index name or pattern to search"),
+		),
+		mcp.WithString("text",
+			mcp.Required(),
+			mcp.Description("Text to search for"),
+		),
+		mcp.WithString("field",
+			mcp.Description("Field to search; required only when the index has several semantic fields"),
+		),
+		mcp.WithString("inference_id",
+			mcp.Description(
+				"Inference endpoint or model that embeds the text for dense_vector, sparse_vector and rank_features fields (default: the server's). semantic_text fields use the endpoint of their mapping.",
+			),
+		),
+		mcp.WithNumber("k",
+			mcp.DefaultNumber(10),
+			mcp.Description("Number of documents to return"),
+		),
+		mcp.WithNumber("num_candidates",
+			mcp.Description("Candidates considered per shard for dense_vector fields (default: 10 times k, at least 100)"),
+		),
+		mcp.WithString("filter",
+			mcp.Description("Query DSL as JSON string restricting the documents searched"),
+		),
+		mcp.WithString("timeout",
+			mcp.Description(
+				"Search timeout as a duration (e.g., '10s'). Capped by the server's maximum.",
+			),
+		),
+		mcp.WithString("cluster",
+			mcp.Description(clusterDescription),
+		),
+	)
+
+	// Add search template tools
+	listSearchTemplatesTool := mcp.NewTool(
+		"list_search_templates",
+		mcp.WithDescription(
+			"List the stored search templates with their mustache source and the parameters each one expects.",
+		),
+		mcp.WithString("cluster",
+			mcp.Description(clusterDescription),
+		),
+	)
+	renderSearchTemplateTool := mcp.NewTool(
+		"render_search_template",
+		mcp.WithDescription(
+			"Render a stored search template with parameters into the search body it produces, without running it.",
+		),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("Id of the stored search template"),
+		),
+		mcp.WithString("params",
+			mcp.Description("Template parameters as a JSON object (e.g., '{\"query_string\": \"timeout\", \"size\": 20}')"),
+		),
+		mcp.WithString("cluster",
+			mcp.Description(clusterDescription),
+		),
+	)
+	searchTemplateTool := mcp.NewTool(
+		"search_template",
+		mcp.WithDescription(
+			"Run a stored search template with parameters. Use list_search_templates to find the templates and their parameters.",
+		),
+		mcp.WithString("index",
+			mcp.Required(),
+			mcp.Description("Index name or pattern to search"),
+		),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("Id of the stored search template"),
+		),
+		mcp.WithString("params",
+			mcp.Description("Template parameters as a JSON object"),
+		),
+		mcp.WithString("timeout",
+			mcp.Description(
+				"Search timeout as a duration (e.g., '10s'). Results gathered before it expires are returned as partial results. Capped by the server's maximum.",
+			),
+		),
+		mcp.WithNumber("terminate_after",
+			mcp.Description(
+				"Maximum number of documents to collect per shard before terminating the search early. Capped by the server's maximum.",
+			),
+		),
+		mcp.WithString("cluster",
+			mcp.Description(clusterDescription),
+		),
+	)
+
+	// Add ES|QL tool
+	esqlTool := mcp.NewTool(
+		"esql",
+		mcp.WithDescription(
+			"Run an ES|QL query (e.g., 'FROM logs-* | WHERE log.level == \"ERROR\" | STATS count = COUNT(*) BY service.name'). Returns the result as columns and rows.",
+		),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("ES|QL query"),
+		),
+		mcp.WithString("params",
+			mcp.Description(
+				"Query parameters as a JSON array, positional for '?' placeholders (e.g., '[\"ERROR\", 10]') or named for '?name' placeholders (e.g., '[{\"level\": \"ERROR\"}]')",
+			),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of rows to return. Capped by the server's maximum, which is also the default."),
+		),
+		mcp.WithString("locale",
+			mcp.Description("Locale used to format dates and numbers (e.g., 'en-US')"),
+		),
+		mcp.WithString("time_zone",
+			mcp.Description("Time zone of date functions and date literals (e.g., 'Europe/Madrid')"),
+		),
+		mcp.WithString("timeout",
+			mcp.Description(
+				"Query timeout as a duration (e.g., '10s'). Capped by the server's maximum.",
+			),
+		),
+		mcp.WithString("cluster",
+			mcp.Description(clusterDescription),
+		),
+	)
+
+	// Add SQL tool
+	sqlTool := mcp.NewTool(
+		"sql",
+		mcp.WithDescription(
+			"Run an Elasticsearch SQL query (e.g., 'SELECT service.name, COUNT(*) FROM \"logs-*\" GROUP BY service.name'). Returns the result as columns and rows, with a cursor for the next page. With translate, returns the equivalent query DSL for the search tool instead.",
+		),
+		mcp.WithString("query",
+			mcp.Description("SQL query (required unless 'cursor' is set)"),
+		),
+		mcp.WithString("params",
+			mcp.Description("Values of the '?' placeholders of the query as a JSON array (e.g., '[\"ERROR\", 10]')"),
+		),
+		mcp.WithNumber("fetch_size",
+			mcp.Description("Maximum number of rows per page. Capped by the server's maximum, which is also the default."),
+		),
+		mcp.WithString("time_zone",
+			mcp.Description("Time zone of date functions and date literals (e.g., 'Europe/Madrid')"),
+		),
+		mcp.WithBoolean("translate",
+			mcp.DefaultBool(false),
+			mcp.Description("Return the query DSL equivalent to the SQL query instead of running it"),
+		),
+		mcp.WithString("cursor",
+			mcp.Description(
+				"Cursor returned by a previous sql call. Fetches the next page of that query; all other parameters except timeout are ignored.",
+			),
+		),
+		mcp.WithString("timeout",
+			mcp.Description(
+				"Query timeout as a duration (e.g., '10s'). Capped by the server's maximum.",
+			),
+		),
+		mcp.WithString("cluster",
+			mcp.Description(clusterDescription),
+		),
+	)
+
+	// Add EQL search tool
+	eqlSearchTool := mcp.NewTool(
+		"eql_search",
+		mcp.WithDescription(
+			"Run an EQL query to find events and ordered event sequences (e.g., 'sequence by host.name [process where process.name == \"cmd.exe\"] [network where true]'). Searches that take longer than wait_for_completion_timeout keep running and return an id to poll.",
+		),
+		mcp.WithString("index",
+			mcp.Description("Index name or pattern to search (required unless 'id' is set)"),
+		),
+		mcp.WithString("query",
+			mcp.Description("EQL query (required unless 'id' is set)"),
+		),
+		mcp.WithString("filter",
+			mcp.Description("Query DSL as JSON string restricting the events the EQL query runs on"),
+		),
+		mcp.WithNumber("size",
+			mcp.DefaultNumber(10),
+			mcp.Description("Maximum number of events or sequences to return"),
+		),
+		mcp.WithString("timestamp_field",
+			mcp.DefaultString(defaultEQLTimestampField),
+			mcp.Description("Field holding the event timestamp"),
+		),
+		mcp.WithString("event_category_field",
+			mcp.DefaultString(defaultEQLEventCategoryField),
+			mcp.Description("Field holding the event category"),
+		),
+		mcp.WithString("tiebreaker_field",
+			mcp.Description("Field used to order events with the same timestamp"),
+		),
+		mcp.WithString("wait_for_completion_timeout",
+			mcp.Description(
+				"How long to wait for results before returning an id to poll, as a duration (e.g., '10s'). Capped by the search timeout.",
+			),
+		),
+		mcp.WithString("id",
+			mcp.Description(
+				"Id returned by a previous eql_search call whose search was still running. Polls that search; all other parameters except timeout and wait_for_completion_timeout are ignored.",
+			),
+		),
+		mcp.WithString("timeout",
+			mcp.Description(
+				"Search timeout as a duration (e.g., '30s'). Capped by the server's maximum.",
+			),
+		),
+		mcp.WithString("cluster",
+			mcp.Description(clusterDescription),
+		),
+	)
+
+	// Add multi-search tool
+	msearchTool := mcp.NewTool(
+		"msearch",
+		mcp.WithDescription(
+			"Execute several searches in one round trip. Returns the results of each search in order; a failing search reports its own error without failing the others.",
+		),
+		mcp.WithString("searches",
+			mcp.Required(),
+			mcp.Description(
+				"JSON array of searches, each an object with 'index' (required), 'query', 'aggs', 'size' (default 10), 'sort' and '_source' (e.g., '[{\"index\": \"logs-*\", \"query\": {\"term\": {\"service.name\": \"api\"}}, \"size\": 0}]')",
+			),
+		),
+		mcp.WithString("timeout",
+			mcp.Description(
+				"Timeout of each search as a duration (e.g., '10s'). Capped by the server's maximum.",
+			),
+		),
+		mcp.WithNumber("terminate_after",
+			mcp.Description(
+				"Maximum number of documents each search collects per shard. Capped by the server's maximum.",
+			),
+		),
+		mcp.WithString("cluster",
+			mcp.Description(clusterDescription),
+		),
+	)
+
+	// Add async search tools
+	asyncSearchSubmitTool := mcp.NewTool(
+		"async_search_submit",
+		mcp.WithDescription(
+			"Start a long-running search, such as a large aggregation over months of data, that keeps running in Elasticsearch after the call returns. Returns the results if the search completes within wait_for_completion_timeout, otherwise partial results and an id to poll with async_search_get.",
+		),
+		mcp.WithString("index",
+			mcp.Required(),
+			mcp.Description("Index name or pattern to search"),
+		),
+		mcp.WithString("query",
+			mcp.DefaultString("{}"),
+			mcp.Description("Elasticsearch query DSL as JSON string"),
+		),
+		mcp.WithNumber("size",
+			mcp.DefaultNumber(10),
+			mcp.Description("Maximum number of documents to return (0-10000)"),
+		),
+		mcp.WithString("sort",
+			mcp.Description("Sort specification as JSON string"),
+		),
+		mcp.WithString("aggs",
+			mcp.Description("Aggregations specification as JSON string"),
+		),
+		mcp.WithString("_source",
+			mcp.Description("Source filtering as JSON string"),
+		),
+		mcp.WithBoolean("track_total_hits",
+			mcp.DefaultBool(true),
+			mcp.Description("Whether to track the total number of hits"),
+		),
+		mcp.WithString("wait_for_completion_timeout",
+			mcp.Description(
+				"How long to wait for the search to complete before returning an id, as a duration (e.g., '10s'). Capped by the call timeout.",
+			),
+		),
+		mcp.WithString("timeout",
+			mcp.Description(
+				"Call timeout as a duration (e.g., '30s'). Bounds how long this call waits, not the search itself. Capped by the server's maximum.",
+			),
+		),
+		mcp.WithNumber("terminate_after",
+			mcp.Description(
+				"Maximum number of documents to collect per shard before terminating the search early. Capped by the server's maximum.",
+			),
+		),
+		mcp.WithString("cluster",
+			mcp.Description(clusterDescription),
+		),
+	)
+	asyncSearchGetTool := mcp.NewTool(
+		"async_search_get",
+		mcp.WithDescription(
+			"Get the status and results so far of a search started with async_search_submit.",
+		),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("Id returned by async_search_submit"),
+		),
+		mcp.WithString("wait_for_completion_timeout",
+			mcp.Description(
+				"How long to wait for the search to complete before returning, as a duration (e.g., '10s'). Capped by the call timeout.",
+			),
+		),
+		mcp.WithString("timeout",
+			mcp.Description(
+				"Call timeout as a duration (e.g., '30s'). Capped by the server's maximum.",
+			),
+		),
+	)
+	asyncSearchDeleteTool := mcp.NewTool(
+		"async_search_delete",
+		mcp.WithDescription(
+			"Stop a search started with async_search_submit and delete its results.",
+		),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("Id returned by async_search_submit"),
+		),
+	)
+
+	// Add query debugging tools
+	validateQueryTool := mcp.NewTool(
+		"validate_query",
+		mcp.WithDescription(
+			"Check whether a query is valid for an index without running it, and show how Elasticsearch rewrites it. Use it to debug a query before searching.",
+		),
+		mcp.WithString("index",
+			mcp.Required(),
+			mcp.Description("Index name or pattern the query is meant for"),
+		),
+		mcp.WithString("query",
+			mcp.DefaultString("{}"),
+			mcp.Description("Elasticsearch query DSL as JSON string"),
+		),
+		mcp.WithBoolean("rewrite",
+			mcp.DefaultBool(true),
+			mcp.Description("Show the query as rewritten into Lucene queries"),
+		),
+		mcp.WithBoolean("all_shards",
+			mcp.DefaultBool(false),
+			mcp.Description("Explain the rewrite on every shard instead of a random one (requires rewrite)"),
+		),
+		mcp.WithString("cluster",
+			mcp.Description(clusterDescription),
+		),
+	)
+	explainDocumentTool := mcp.NewTool(
+		"explain_document",
+		mcp.WithDescription(
+			"Explain why a specific document does or does not match a query, and how its score is computed.",
+		),
+		mcp.WithString("index",
+			mcp.Required(),
+			mcp.Description("Name of the index holding the document (not a pattern)"),
+		),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("Document id"),
+		),
+		mcp.WithString("query",
+			mcp.DefaultString("{}"),
+			mcp.Description("Elasticsearch query DSL as JSON string"),
+		),
+		mcp.WithString("cluster",
+			mcp.Description(clusterDescription),
+		),
 	)
 
 	// Register tool handlers
+	s.AddTool(listClustersTool, esHandler.handleListClusters)
 	s.AddTool(listIndicesTool, esHandler.handleListIndices)
 	s.AddTool(getMappingsTool, esHandler.handleGetMappings)
 	s.AddTool(searchTool, esHandler.handleSearch)
+	s.AddTool(countTool, esHandler.handleCount)
+	s.AddTool(knnSearchTool, esHandler.handleKNNSearch)
+	s.AddTool(semanticSearchTool, esHandler.handleSemanticSearch)
+	s.AddTool(listSearchTemplatesTool, esHandler.handleListSearchTemplates)
+	s.AddTool(renderSearchTemplateTool, esHandler.handleRenderSearchTemplate)
+	s.AddTool(searchTemplateTool, esHandler.handleSearchTemplate)
+	s.AddTool(msearchTool, esHandler.handleMsearch)
+	s.AddTool(validateQueryTool, esHandler.handleValidateQuery)
+	s.AddTool(explainDocumentTool, esHandler.handleExplainDocument)
+	s.AddTool(asyncSearchSubmitTool, esHandler.handleAsyncSearchSubmit)
+	s.AddTool(asyncSearchGetTool, esHandler.handleAsyncSearchGet)
+	s.AddTool(asyncSearchDeleteTool, esHandler.handleAsyncSearchDelete)
+	s.AddTool(esqlTool, esHandler.handleESQL)
+	s.AddTool(sqlTool, esHandler.handleSQL)
+	s.AddTool(eqlSearchTool, esHandler.handleEQLSearch)
 
-	log.Info().Msg("MCP Elasticsearch server initialized, serving on stdio")
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	if err := server.ServeStdio(s); err != nil {
+	if err := serve(ctx, s, cfg.Server, auth, log); err != nil {
 		return fmt.Errorf("server error: %w", err)
 	}
 
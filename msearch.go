@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxMsearchItems caps the number of searches of a single msearch call.
+const maxMsearchItems = 50
+
+// searchSpec is a search given as separate arguments, such as one search of
+// an msearch call. Query, aggs, sort and _source may be given as JSON values
+// or, like the search tool's arguments, as JSON strings.
+type searchSpec struct {
+	Index  string          `json:"index"`
+	Query  json.RawMessage `json:"query"`
+	Aggs   json.RawMessage `json:"aggs"`
+	Size   *int            `json:"size"`
+	Sort   json.RawMessage `json:"sort"`
+	Source json.RawMessage `json:"_source"`
+}
+
+// body builds the search body.
+func (item searchSpec) body(budget queryBudget) (map[string]any, error) {
+	if item.Index == "" {
+		return nil, errors.New("index is required")
+	}
+
+	size := 10
+	if item.Size != nil {
+		size = *item.Size
+	}
+	if size < 0 || size > 10000 {
+		return nil, errors.New("size must be between 0 and 10000")
+	}
+
+	var queryString string
+	if _, err := jsonArgument(item.Query, &queryString); err != nil {
+		return nil, fmt.Errorf("invalid query JSON: %w", err)
+	}
+	query, err := parseQuery(queryString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query JSON: %w", err)
+	}
+
+	body := map[string]any{
+		"query":            query,
+		"size":             size,
+		"track_total_hits": true,
+	}
+	if budget.Timeout > 0 {
+		body["timeout"] = esDuration(budget.Timeout)
+	}
+	if budget.TerminateAfter > 0 {
+		body["terminate_after"] = budget.TerminateAfter
+	}
+
+	var aggs map[string]any
+	if ok, err := jsonArgument(item.Aggs, &aggs); err != nil {
+		return nil, fmt.Errorf("invalid aggs JSON: %w", err)
+	} else if ok {
+		body["aggs"] = aggs
+	}
+
+	var sort any
+	if ok, err := jsonArgument(item.Sort, &sort); err != nil {
+		return nil, fmt.Errorf("invalid sort JSON: %w", err)
+	} else if ok {
+		body["sort"] = sort
+	}
+
+	var source any
+	if ok, err := jsonArgument(item.Source, &source); err != nil {
+		return nil, fmt.Errorf("invalid _source JSON: %w", err)
+	} else if ok {
+		body["_source"] = source
+	}
+
+	return body, nil
+}
+
+// jsonArgument decodes a JSON value into v, decoding it a second time when
+// it is a JSON string holding JSON, as produced by clients that pass every
+// argument as a string. It reports whether a value was present. A string
+// target receives the JSON text itself.
+func jsonArgument(raw json.RawMessage, v any) (bool, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return false, nil
+	}
+
+	text := string(raw)
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if s == "" {
+			return false, nil
+		}
+		text = s
+	}
+
+	if target, ok := v.(*string); ok {
+		*target = text
+		return true, nil
+	}
+	return true, json.Unmarshal([]byte(text), v)
+}
+
+// msearchResponse is the response of _msearch. Each response is either a
+// search response or an error.
+type msearchResponse struct {
+	Took      int               `json:"took"`
+	Responses []json.RawMessage `json:"responses"`
+}
+
+func (h *ElasticsearchHandler) handleMsearch(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+
+	searchesString, err := request.RequireString("searches")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing searches parameter")
+		return mcp.NewToolResultError("Missing 'searches' parameter"), nil
+	}
+
+	var items []searchSpec
+	if err := json.Unmarshal([]byte(searchesString), &items); err != nil {
+		log.Error().Err(err).Msg("Invalid searches JSON")
+		return mcp.NewToolResultError(
+			fmt.Sprintf("Invalid searches JSON, expected an array of search objects: %v", err),
+		), nil
+	}
+	if len(items) == 0 || len(items) > maxMsearchItems {
+		return mcp.NewToolResultError(
+			fmt.Sprintf("searches must hold between 1 and %d searches", maxMsearchItems),
+		), nil
+	}
+
+	c, err := h.clusterFor(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, budget, err := h.queryBudget(ctx, "msearch", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
+	log.Info().Int("searches", len(items)).Msg("Executing multi-search")
+
+	// Searches that cannot be sent get their error right away; the others
+	// are batched, remembering their position in the results.
+	results := make([]map[string]any, len(items))
+	bodies := make([]map[string]any, len(items))
+	var (
+		batch   bytes.Buffer
+		batched []int
+		indices []string
+		audited []map[string]any
+	)
+	for i, item := range items {
+		results[i] = map[string]any{"index": item.Index}
+
+		body, err := item.body(budget)
+		if err == nil {
+			err = h.indexAccess.check(ctx, c, item.Index)
+		}
+		if err == nil {
+			if violation := h.policy.check(body); violation != nil {
+				err = violation
+			}
+		}
+		if err != nil {
+			log.Warn().Err(err).Int("search", i).Str("index", item.Index).Msg("Search rejected")
+			results[i]["error"] = err.Error()
+			continue
+		}
+
+		header, _ := json.Marshal(map[string]any{"index": item.Index})
+		line, err := json.Marshal(body)
+		if err != nil {
+			results[i]["error"] = "failed to create search request"
+			continue
+		}
+		batch.Write(header)
+		batch.WriteByte('\n')
+		batch.Write(line)
+		batch.WriteByte('\n')
+
+		bodies[i] = body
+		batched = append(batched, i)
+		indices = append(indices, item.Index)
+		audited = append(audited, map[string]any{"index": item.Index, "body": body})
+	}
+	auditRequest(ctx, strings.Join(indices, ","), audited)
+
+	var took int
+	if len(batched) > 0 {
+		msearch, err := c.msearch(ctx, batch.Bytes())
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				log.Warn().Dur("timeout", budget.Timeout).Msg("Multi-search deadline exceeded")
+				return mcp.NewToolResultError(fmt.Sprintf(
+					"Multi-search did not complete within its %s timeout; send fewer or narrower searches",
+					budget.Timeout,
+				)), nil
+			}
+			log.Error().Err(err).Msg("Failed to execute multi-search")
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to execute multi-search: %v", err)), nil
+		}
+		took = msearch.Took
+
+		responses := make([]*SearchResponse, len(items))
+		var hits []map[string]any
+		for n, i := range batched {
+			if n >= len(msearch.Responses) {
+				results[i]["error"] = "missing response"
+				continue
+			}
+			if responses[i] = msearchItemResponse(results[i], msearch.Responses[n]); responses[i] != nil {
+				hits = append(hits, responses[i].Hits.Hits...)
+			}
+		}
+
+		// The indices of the hits of all searches are resolved at once.
+		names, errResult := h.redactionNames(ctx, log, c, hits)
+		if errResult != nil {
+			return errResult, nil
+		}
+		for i, searchResponse := range responses {
+			if searchResponse != nil {
+				h.redactor.redactSearchResponse(searchResponse, bodies[i], names)
+				msearchItemResult(results[i], searchResponse)
+			}
+		}
+	}
+
+	response := map[string]any{
+		"cluster":   c.name,
+		"took":      took,
+		"budget":    budget.response(),
+		"responses": results,
+	}
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal multi-search response")
+		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+	}
+
+	log.Info().
+		Int("searches", len(items)).
+		Int("batched", len(batched)).
+		Int("took_ms", took).
+		Msg("Multi-search executed successfully")
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
+
+// msearchItemResponse decodes the _msearch response of one search. When the
+// search failed, it records the error in result and returns nil.
+func msearchItemResponse(result map[string]any, raw json.RawMessage) *SearchResponse {
+	var failure struct {
+		Error  any `json:"error"`
+		Status int `json:"status"`
+	}
+	if err := json.Unmarshal(raw, &failure); err != nil {
+		result["error"] = fmt.Sprintf("failed to decode response: %v", err)
+		return nil
+	}
+	if failure.Error != nil {
+		result["error"] = failure.Error
+		result["status"] = failure.Status
+		return nil
+	}
+
+	var searchResponse SearchResponse
+	if err := json.Unmarshal(raw, &searchResponse); err != nil {
+		result["error"] = fmt.Sprintf("failed to decode response: %v", err)
+		return nil
+	}
+	return &searchResponse
+}
+
+// msearchItemResult fills the result of one search from its redacted
+// response.
+func msearchItemResult(result map[string]any, searchResponse *SearchResponse) {
+	result["took"] = searchResponse.Took
+	result["timed_out"] = searchResponse.TimedOut
+	result["terminated_early"] = searchResponse.TerminatedEarly
+	result["partial"] = searchResponse.TimedOut || searchResponse.TerminatedEarly
+	result["total_hits"] = searchResponse.Hits.Total.Value
+	result["max_score"] = searchResponse.Hits.MaxScore
+	result["hits"] = searchResponse.Hits.Hits
+	if len(searchResponse.Aggregations) > 0 {
+		result["aggregations"] = searchResponse.Aggregations
+	}
+}
+
+// msearch runs a batch of searches in newline-delimited _msearch format.
+func (c *cluster) msearch(ctx context.Context, body []byte) (*msearchResponse, error) {
+	res, err := c.client.Msearch(
+		bytes.NewReader(body),
+		c.client.Msearch.WithContext(ctx),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var response msearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &response, nil
+}
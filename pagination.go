@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/rs/zerolog"
+)
+
+var errUnknownCursor = errors.New("unknown or expired cursor, start a new search with paginate=true")
+
+// PaginationConfig configures cursor based search pagination.
+type PaginationConfig struct {
+	// KeepAlive is how long an idle cursor, and its point in time, stays
+	// open between pages.
+	KeepAlive time.Duration `yaml:"keep_alive"`
+	// MaxCursors caps the number of cursors open at once.
+	MaxCursors int `yaml:"max_cursors"`
+}
+
+// cursorState is an open search cursor: a point in time on a cluster, the
+// search to page through and the sort values of the last hit returned.
+type cursorState struct {
+	id             string
+	clientID       string
+	cluster        string
+	index          string
+	pitID          string
+	request        map[string]any
+	searchAfter    []any
+	size           int
+	trackTotalHits bool
+	keepAlive      time.Duration
+	expires        time.Time
+}
+
+// body returns the search body of the next page.
+func (s *cursorState) body() map[string]any {
+	body := make(map[string]any, len(s.request)+3)
+	for key, value := range s.request {
+		body[key] = value
+	}
+	body["size"] = s.size
+	body["pit"] = map[string]any{
+		"id":         s.pitID,
+		"keep_alive": esDuration(s.keepAlive),
+	}
+	if s.searchAfter != nil {
+		body["search_after"] = s.searchAfter
+	}
+	return body
+}
+
+// cursorStore holds the open cursors. Cursors are only usable by the client
+// that opened them. A cursor is taken out of the store while its next page is
+// fetched, so that concurrent calls cannot use it twice.
+type cursorStore struct {
+	cfg PaginationConfig
+
+	mu      sync.Mutex
+	cursors map[string]*cursorState
+}
+
+func newCursorStore(cfg PaginationConfig) *cursorStore {
+	return &cursorStore{cfg: cfg, cursors: make(map[string]*cursorState)}
+}
+
+// take removes the cursor from the store and returns it. It must be put
+// back for the next page.
+func (s *cursorStore) take(id, clientID string) (*cursorState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cursor, ok := s.cursors[id]
+	if !ok || cursor.clientID != clientID || time.Now().After(cursor.expires) {
+		return nil, errUnknownCursor
+	}
+	delete(s.cursors, id)
+	return cursor, nil
+}
+
+func (s *cursorStore) put(cursor *cursorState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.cursors) >= s.cfg.MaxCursors {
+		return fmt.Errorf("too many open cursors (maximum %d)", s.cfg.MaxCursors)
+	}
+	cursor.expires = time.Now().Add(s.cfg.KeepAlive)
+	s.cursors[cursor.id] = cursor
+	return nil
+}
+
+// sweep removes and returns the cursors that expired.
+func (s *cursorStore) sweep() []*cursorState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []*cursorState
+	now := time.Now()
+	for id, cursor := range s.cursors {
+		if now.After(cursor.expires) {
+			expired = append(expired, cursor)
+			delete(s.cursors, id)
+		}
+	}
+	return expired
+}
+
+// openCursor opens a point in time on index and prepares the search to page
+// through it with search_after.
+func (h *ElasticsearchHandler) openCursor(
+	ctx context.Context,
+	c *cluster,
+	index string,
+	searchRequest map[string]any,
+	size int,
+	trackTotalHits bool,
+) (*cursorState, error) {
+	h.sweepCursors()
+
+	id, err := newCursorID()
+	if err != nil {
+		return nil, err
+	}
+
+	pitID, err := c.openPointInTime(ctx, index, h.cursors.cfg.KeepAlive)
+	if err != nil {
+		return nil, err
+	}
+
+	request := make(map[string]any, len(searchRequest))
+	for key, value := range searchRequest {
+		request[key] = value
+	}
+	delete(request, "from")
+	request["sort"] = withTiebreaker(request["sort"])
+
+	return &cursorState{
+		id:             id,
+		clientID:       clientIdentityFromContext(ctx).ID,
+		cluster:        c.name,
+		index:          index,
+		pitID:          pitID,
+		request:        request,
+		size:           size,
+		trackTotalHits: trackTotalHits,
+		keepAlive:      h.cursors.cfg.KeepAlive,
+	}, nil
+}
+
+// lastSort returns the sort values of the last hit of a page, the position
+// the next page starts after. It must be taken before the hits are
+// redacted, as redaction rewrites sort values.
+func lastSort(searchResponse *SearchResponse) []any {
+	hits := searchResponse.Hits.Hits
+	if len(hits) == 0 {
+		return nil
+	}
+	searchAfter, _ := hits[len(hits)-1]["sort"].([]any)
+	return slices.Clone(searchAfter)
+}
+
+// advanceCursor records the position after a page of results and adds the
+// cursor for the next page to the tool response. searchAfter holds the sort
+// values of the page's last hit, as returned by lastSort. The point in time
+// is closed once the results are exhausted.
+func (h *ElasticsearchHandler) advanceCursor(
+	log zerolog.Logger,
+	c *cluster,
+	cursor *cursorState,
+	searchResponse *SearchResponse,
+	searchAfter []any,
+	response map[string]any,
+) {
+	if searchResponse.PitID != "" {
+		cursor.pitID = searchResponse.PitID
+	}
+	// Aggregations are only computed for the first page.
+	delete(cursor.request, "aggs")
+	delete(cursor.request, "aggregations")
+
+	hits := searchResponse.Hits.Hits
+	if cursor.size == 0 || len(hits) < cursor.size || searchAfter == nil {
+		h.closeCursor(c, cursor)
+		response["cursor"] = nil
+		response["has_more"] = false
+		return
+	}
+
+	cursor.searchAfter = searchAfter
+	if err := h.cursors.put(cursor); err != nil {
+		log.Warn().Err(err).Msg("Failed to store search cursor")
+		h.closeCursor(c, cursor)
+		response["cursor"] = nil
+		response["has_more"] = true
+		response["cursor_error"] = err.Error()
+		return
+	}
+
+	response["cursor"] = cursor.id
+	response["has_more"] = true
+}
+
+// restoreCursor puts back a cursor whose page could not be fetched.
+func (h *ElasticsearchHandler) restoreCursor(log zerolog.Logger, c *cluster, cursor *cursorState) {
+	if err := h.cursors.put(cursor); err != nil {
+		log.Warn().Err(err).Msg("Failed to store search cursor")
+		h.closeCursor(c, cursor)
+	}
+}
+
+// closeCursor closes the point in time of a cursor. Failures are only
+// logged: Elasticsearch releases the point in time once its keep-alive
+// lapses anyway.
+func (h *ElasticsearchHandler) closeCursor(c *cluster, cursor *cursorState) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := c.closePointInTime(ctx, cursor.pitID); err != nil {
+		h.logger.Warn().Err(err).Str("cluster", c.name).Msg("Failed to close point in time")
+	}
+}
+
+// sweepCursors forgets expired cursors and closes their points in time.
+func (h *ElasticsearchHandler) sweepCursors() {
+	for _, cursor := range h.cursors.sweep() {
+		if c, ok := h.clusters[cursor.cluster]; ok {
+			h.closeCursor(c, cursor)
+		}
+	}
+}
+
+// handleSearchPage returns the next page of a cursor opened by a previous
+// search with paginate=true.
+func (h *ElasticsearchHandler) handleSearchPage(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+	id string,
+) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+	h.sweepCursors()
+
+	cursor, err := h.cursors.take(id, clientIdentityFromContext(ctx).ID)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	c, ok := h.clusters[cursor.cluster]
+	if !ok {
+		return mcp.NewToolResultError(errUnknownCursor.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, budget, err := h.queryBudget(ctx, "search", request)
+	if err != nil {
+		h.restoreCursor(log, c, cursor)
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
+	log.Info().Str("index", cursor.index).Msg("Fetching next search page")
+	// Pages are searched through the point in time, which names no index.
+	auditRequest(ctx, cursor.index, nil)
+
+	body := cursor.body()
+	searchResponse, errResult := h.executeSearch(ctx, log, c, "", body, budget, cursor.trackTotalHits)
+	if errResult != nil {
+		// Keep the cursor so that the page can be retried.
+		h.restoreCursor(log, c, cursor)
+		return errResult, nil
+	}
+
+	searchAfter := lastSort(searchResponse)
+	if errResult := h.redactSearchResponse(ctx, log, c, searchResponse, body); errResult != nil {
+		h.restoreCursor(log, c, cursor)
+		return errResult, nil
+	}
+
+	response := searchResult(c, cursor.index, searchResponse, budget)
+	response["size"] = cursor.size
+	h.advanceCursor(log, c, cursor, searchResponse, searchAfter, response)
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal search response")
+		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+	}
+
+	log.Info().
+		Str("index", cursor.index).
+		Int("returned_hits", len(searchResponse.Hits.Hits)).
+		Int("took_ms", searchResponse.Took).
+		Msg("Search page fetched successfully")
+
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
+
+func (c *cluster) openPointInTime(ctx context.Context, index string, keepAlive time.Duration) (string, error) {
+	res, err := c.client.OpenPointInTime(
+		strings.Split(index, ","),
+		esDuration(keepAlive),
+		c.client.OpenPointInTime.WithContext(ctx),
+	)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return "", fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var pit struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&pit); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	return pit.ID, nil
+}
+
+func (c *cluster) closePointInTime(ctx context.Context, pitID string) error {
+	body, err := json.Marshal(map[string]string{"id": pitID})
+	if err != nil {
+		return err
+	}
+
+	res, err := c.client.ClosePointInTime(
+		c.client.ClosePointInTime.WithContext(ctx),
+		c.client.ClosePointInTime.WithBody(strings.NewReader(string(body))),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+	return nil
+}
+
+// withTiebreaker appends the _shard_doc tiebreaker to a sort specification so
+// that search_after never skips or repeats hits with equal sort values.
+// Without a sort, hits are sorted by score.
+func withTiebreaker(sort any) []any {
+	var sorts []any
+	switch s := sort.(type) {
+	case nil:
+		sorts = []any{map[string]any{"_score": "desc"}}
+	case []any:
+		sorts = append(sorts, s...)
+	default:
+		sorts = []any{s}
+	}
+
+	for _, field := range sorts {
+		switch f := field.(type) {
+		case string:
+			if f == "_shard_doc" {
+				return sorts
+			}
+		case map[string]any:
+			if _, ok := f["_shard_doc"]; ok {
+				return sorts
+			}
+		}
+	}
+	return append(sorts, map[string]any{"_shard_doc": "asc"})
+}
+
+func newCursorID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate cursor: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// esDuration formats a duration in Elasticsearch time units.
+func esDuration(d time.Duration) string {
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
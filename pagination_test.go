@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWithTiebreaker(t *testing.T) {
+	tiebreaker := map[string]any{"_shard_doc": "asc"}
+
+	tests := []struct {
+		name string
+		sort any
+		want []any
+	}{
+		{"no sort", nil, []any{map[string]any{"_score": "desc"}, tiebreaker}},
+		{"single field", "timestamp", []any{"timestamp", tiebreaker}},
+		{"list", []any{map[string]any{"timestamp": "desc"}}, []any{map[string]any{"timestamp": "desc"}, tiebreaker}},
+		{"tiebreaker already set", []any{"timestamp", "_shard_doc"}, []any{"timestamp", "_shard_doc"}},
+		{"tiebreaker object already set", []any{map[string]any{"_shard_doc": "desc"}}, []any{map[string]any{"_shard_doc": "desc"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withTiebreaker(tt.sort); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("withTiebreaker(%v) = %v, want %v", tt.sort, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLastSortSurvivesRedaction(t *testing.T) {
+	var resp SearchResponse
+	resp.Hits.Hits = []map[string]any{
+		{"_index": "users", "sort": []any{"alice@example.com", 1.0}},
+		{"_index": "users", "sort": []any{"bob@example.com", 2.0}},
+	}
+
+	searchAfter := lastSort(&resp)
+	resp.Hits.Hits[1]["sort"].([]any)[0] = "<redacted>"
+
+	if want := []any{"bob@example.com", 2.0}; !reflect.DeepEqual(searchAfter, want) {
+		t.Errorf("lastSort() = %v, want %v", searchAfter, want)
+	}
+
+	resp.Hits.Hits = nil
+	if got := lastSort(&resp); got != nil {
+		t.Errorf("lastSort() of an empty page = %v, want nil", got)
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Search policy rule names, reported back to the caller when a rule fires.
+const (
+	ruleScripts          = "no_scripts"
+	ruleRuntimeMappings  = "no_runtime_mappings"
+	ruleLeadingWildcards = "no_leading_wildcards"
+	ruleDeniedQuery      = "denied_query"
+	ruleAggregationDepth = "max_aggregation_depth"
+	ruleBucketSize       = "max_bucket_size"
+)
+
+// bucketSizeAggregations are the aggregations whose "size" controls how
+// many buckets they build.
+var bucketSizeAggregations = map[string]bool{
+	"terms":             true,
+	"multi_terms":       true,
+	"significant_terms": true,
+	"significant_text":  true,
+	"composite":         true,
+	"rare_terms":        true,
+}
+
+type SearchPolicyConfig struct {
+	Enabled               bool     `yaml:"enabled"`
+	AllowScripts          bool     `yaml:"allow_scripts"`
+	AllowRuntimeMappings  bool     `yaml:"allow_runtime_mappings"`
+	AllowLeadingWildcards bool     `yaml:"allow_leading_wildcards"`
+	DeniedQueries         []string `yaml:"denied_queries,omitempty"`
+	MaxAggregationDepth   int      `yaml:"max_aggregation_depth"`
+	MaxBucketSize         int      `yaml:"max_bucket_size"`
+}
+
+// PolicyViolation describes the search policy rule a request broke.
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (v *PolicyViolation) Error() string {
+	return fmt.Sprintf("%s at %s: %s", v.Rule, v.Path, v.Message)
+}
+
+// toolResult renders the violation as a structured tool error.
+func (v *PolicyViolation) toolResult() *mcp.CallToolResult {
+	jsonBytes, err := json.Marshal(map[string]any{
+		"error":   "search rejected by policy",
+		"rule":    v.Rule,
+		"path":    v.Path,
+		"message": v.Message,
+	})
+	if err != nil {
+		return mcp.NewToolResultError(v.Error())
+	}
+	return mcp.NewToolResultError(string(jsonBytes))
+}
+
+// searchPolicy inspects parsed search bodies and rejects scripts and other
+// expensive or dangerous constructs before they reach Elasticsearch.
+type searchPolicy struct {
+	cfg           SearchPolicyConfig
+	deniedQueries map[string]bool
+}
+
+func newSearchPolicy(cfg SearchPolicyConfig) *searchPolicy {
+	denied := make(map[string]bool, len(cfg.DeniedQueries))
+	for _, q := range cfg.DeniedQueries {
+		denied[q] = true
+	}
+	return &searchPolicy{cfg: cfg, deniedQueries: denied}
+}
+
+// check returns the first violation found in the search body, or nil.
+func (p *searchPolicy) check(body map[string]any) *PolicyViolation {
+	if p == nil || !p.cfg.Enabled {
+		return nil
+	}
+
+	if runtime, ok := body["runtime_mappings"]; ok {
+		if !p.cfg.AllowRuntimeMappings {
+			return &PolicyViolation{
+				Rule:    ruleRuntimeMappings,
+				Path:    "runtime_mappings",
+				Message: "runtime mappings are not allowed",
+			}
+		}
+		if v := p.checkScripts(runtime, "runtime_mappings"); v != nil {
+			return v
+		}
+	}
+
+	if _, ok := body["script_fields"]; ok && !p.cfg.AllowScripts {
+		return &PolicyViolation{
+			Rule:    ruleScripts,
+			Path:    "script_fields",
+			Message: "script fields are not allowed",
+		}
+	}
+
+	for _, key := range sortedKeys(body) {
+		if key == "runtime_mappings" {
+			continue
+		}
+		if v := p.checkScripts(body[key], key); v != nil {
+			return v
+		}
+	}
+
+	if query, ok := body["query"]; ok {
+		if v := p.checkQuery(query, "query"); v != nil {
+			return v
+		}
+	}
+
+	for _, key := range []string{"aggs", "aggregations"} {
+		if aggs, ok := body[key].(map[string]any); ok {
+			if v := p.checkAggregations(aggs, key, 1); v != nil {
+				return v
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkScripts rejects any script anywhere below value: script queries,
+// script_score functions, scripted aggregations, script sorts and scripted
+// runtime fields.
+func (p *searchPolicy) checkScripts(value any, path string) *PolicyViolation {
+	if p.cfg.AllowScripts {
+		return nil
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			childPath := path + "." + key
+			switch key {
+			case "script", "scripted_metric", "script_score", "_script", "script_fields":
+				return &PolicyViolation{
+					Rule:    ruleScripts,
+					Path:    childPath,
+					Message: fmt.Sprintf("%s is not allowed", key),
+				}
+			}
+			if violation := p.checkScripts(v[key], childPath); violation != nil {
+				return violation
+			}
+		}
+	case []any:
+		for i, item := range v {
+			if violation := p.checkScripts(item, fmt.Sprintf("%s[%d]", path, i)); violation != nil {
+				return violation
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkQuery walks the query DSL looking for denied query types and leading
+// wildcards.
+func (p *searchPolicy) checkQuery(value any, path string) *PolicyViolation {
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			childPath := path + "." + key
+
+			if p.deniedQueries[key] {
+				return &PolicyViolation{
+					Rule:    ruleDeniedQuery,
+					Path:    childPath,
+					Message: fmt.Sprintf("%s queries are not allowed", key),
+				}
+			}
+
+			if !p.cfg.AllowLeadingWildcards {
+				if violation := checkLeadingWildcard(key, v[key], childPath); violation != nil {
+					return violation
+				}
+			}
+
+			if violation := p.checkQuery(v[key], childPath); violation != nil {
+				return violation
+			}
+		}
+	case []any:
+		for i, item := range v {
+			if violation := p.checkQuery(item, fmt.Sprintf("%s[%d]", path, i)); violation != nil {
+				return violation
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkLeadingWildcard flags wildcard, prefix-less regexp, query_string and
+// simple_query_string clauses that force Elasticsearch to scan every term
+// of a field.
+func checkLeadingWildcard(queryType string, body any, path string) *PolicyViolation {
+	clause, ok := body.(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	var patterns []string
+	switch queryType {
+	case "wildcard", "regexp":
+		for _, fieldBody := range clause {
+			switch fb := fieldBody.(type) {
+			case string:
+				patterns = append(patterns, fb)
+			case map[string]any:
+				for _, key := range []string{"value", "wildcard"} {
+					if s, ok := fb[key].(string); ok {
+						patterns = append(patterns, s)
+					}
+				}
+			}
+		}
+	case "query_string":
+		if allowed, ok := clause["allow_leading_wildcard"].(bool); ok && !allowed {
+			return nil
+		}
+		if q, ok := clause["query"].(string); ok {
+			patterns = append(patterns, strings.Fields(q)...)
+		}
+	case "simple_query_string":
+		if q, ok := clause["query"].(string); ok {
+			for _, term := range strings.Fields(q) {
+				// Strip the +, - and | operators along with any grouping.
+				patterns = append(patterns, strings.TrimLeft(term, "+-|"))
+			}
+		}
+	default:
+		return nil
+	}
+
+	for _, pattern := range patterns {
+		if i := strings.LastIndex(pattern, ":"); queryType == "query_string" && i >= 0 {
+			pattern = pattern[i+1:]
+		}
+		pattern = strings.TrimLeft(pattern, "(\"")
+		if strings.HasPrefix(pattern, "*") || strings.HasPrefix(pattern, "?") ||
+			(queryType == "regexp" && strings.HasPrefix(pattern, ".")) {
+			return &PolicyViolation{
+				Rule:    ruleLeadingWildcards,
+				Path:    path,
+				Message: fmt.Sprintf("leading wildcard in %q is not allowed", pattern),
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkAggregations enforces the aggregation nesting and bucket size limits.
+func (p *searchPolicy) checkAggregations(aggs map[string]any, path string, depth int) *PolicyViolation {
+	if p.cfg.MaxAggregationDepth > 0 && depth > p.cfg.MaxAggregationDepth {
+		return &PolicyViolation{
+			Rule: ruleAggregationDepth,
+			Path: path,
+			Message: fmt.Sprintf(
+				"aggregations are nested %d levels deep, the maximum is %d",
+				depth, p.cfg.MaxAggregationDepth,
+			),
+		}
+	}
+
+	for _, name := range sortedKeys(aggs) {
+		agg, ok := aggs[name].(map[string]any)
+		if !ok {
+			continue
+		}
+		aggPath := path + "." + name
+
+		for _, aggType := range sortedKeys(agg) {
+			body, ok := agg[aggType].(map[string]any)
+			if !ok {
+				continue
+			}
+
+			if aggType == "aggs" || aggType == "aggregations" {
+				if v := p.checkAggregations(body, aggPath+"."+aggType, depth+1); v != nil {
+					return v
+				}
+				continue
+			}
+
+			if p.cfg.MaxBucketSize > 0 && bucketSizeAggregations[aggType] {
+				if size, ok := bucketSize(body["size"]); ok && size > p.cfg.MaxBucketSize {
+					return &PolicyViolation{
+						Rule: ruleBucketSize,
+						Path: aggPath + "." + aggType + ".size",
+						Message: fmt.Sprintf(
+							"%s aggregation size %d exceeds the maximum of %d",
+							aggType, size, p.cfg.MaxBucketSize,
+						),
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// bucketSize reads an aggregation size, which Elasticsearch also accepts as
+// a string.
+func bucketSize(value any) (int, bool) {
+	var size float64
+	switch v := value.(type) {
+	case float64:
+		size = v
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, false
+		}
+		size = parsed
+	default:
+		return 0, false
+	}
+	return int(min(size, math.MaxInt32)), true
+}
+
+// sortedKeys returns the keys of m in a stable order so that the same body
+// always reports the same violation.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
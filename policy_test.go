@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSearchPolicyCheck(t *testing.T) {
+	policy := newSearchPolicy(SearchPolicyConfig{
+		Enabled:             true,
+		DeniedQueries:       []string{"more_like_this"},
+		MaxAggregationDepth: 2,
+		MaxBucketSize:       100,
+	})
+
+	tests := []struct {
+		name     string
+		body     string
+		wantRule string
+		wantPath string
+	}{
+		{
+			name: "plain match query",
+			body: `{"query": {"match": {"message": "error"}}}`,
+		},
+		{
+			name:     "script query",
+			body:     `{"query": {"bool": {"filter": [{"script": {"script": "true"}}]}}}`,
+			wantRule: ruleScripts,
+			wantPath: "query.bool.filter[0].script",
+		},
+		{
+			name:     "script sort",
+			body:     `{"sort": [{"_script": {"type": "number"}}]}`,
+			wantRule: ruleScripts,
+			wantPath: "sort[0]._script",
+		},
+		{
+			name:     "script fields",
+			body:     `{"script_fields": {"x": {"script": "1"}}}`,
+			wantRule: ruleScripts,
+			wantPath: "script_fields",
+		},
+		{
+			name:     "runtime mappings",
+			body:     `{"runtime_mappings": {"day": {"type": "keyword"}}}`,
+			wantRule: ruleRuntimeMappings,
+			wantPath: "runtime_mappings",
+		},
+		{
+			name:     "denied query type",
+			body:     `{"query": {"bool": {"must": {"more_like_this": {"like": "x"}}}}}`,
+			wantRule: ruleDeniedQuery,
+			wantPath: "query.bool.must.more_like_this",
+		},
+		{
+			name:     "wildcard with leading star",
+			body:     `{"query": {"wildcard": {"user": {"value": "*son"}}}}`,
+			wantRule: ruleLeadingWildcards,
+			wantPath: "query.wildcard",
+		},
+		{
+			name: "wildcard with trailing star",
+			body: `{"query": {"wildcard": {"user": "jo*"}}}`,
+		},
+		{
+			name:     "regexp starting with dot",
+			body:     `{"query": {"regexp": {"user": ".*son"}}}`,
+			wantRule: ruleLeadingWildcards,
+			wantPath: "query.regexp",
+		},
+		{
+			name:     "query_string field with leading wildcard",
+			body:     `{"query": {"query_string": {"query": "status:200 AND user:*son"}}}`,
+			wantRule: ruleLeadingWildcards,
+			wantPath: "query.query_string",
+		},
+		{
+			name: "query_string disallowing leading wildcards",
+			body: `{"query": {"query_string": {"query": "*son", "allow_leading_wildcard": false}}}`,
+		},
+		{
+			name:     "simple_query_string with leading wildcard",
+			body:     `{"query": {"simple_query_string": {"query": "error +*son"}}}`,
+			wantRule: ruleLeadingWildcards,
+			wantPath: "query.simple_query_string",
+		},
+		{
+			name: "simple_query_string prefix",
+			body: `{"query": {"simple_query_string": {"query": "-jo* | error"}}}`,
+		},
+		{
+			name:     "aggregations nested too deep",
+			body:     `{"aggs": {"a": {"terms": {"field": "x"}, "aggs": {"b": {"terms": {"field": "y"}, "aggs": {"c": {"avg": {"field": "z"}}}}}}}}`,
+			wantRule: ruleAggregationDepth,
+			wantPath: "aggs.a.aggs.b.aggs",
+		},
+		{
+			name:     "bucket size over the maximum",
+			body:     `{"aggs": {"a": {"terms": {"field": "x", "size": 1000}}}}`,
+			wantRule: ruleBucketSize,
+			wantPath: "aggs.a.terms.size",
+		},
+		{
+			name:     "bucket size as a string",
+			body:     `{"aggs": {"a": {"composite": {"size": "1000", "sources": []}}}}`,
+			wantRule: ruleBucketSize,
+			wantPath: "aggs.a.composite.size",
+		},
+		{
+			name: "bucket size within the maximum",
+			body: `{"aggs": {"a": {"terms": {"field": "x", "size": "50"}}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]any
+			if err := json.Unmarshal([]byte(tt.body), &body); err != nil {
+				t.Fatalf("invalid test body: %v", err)
+			}
+
+			violation := policy.check(body)
+			if tt.wantRule == "" {
+				if violation != nil {
+					t.Fatalf("check() = %v, want no violation", violation)
+				}
+				return
+			}
+			if violation == nil {
+				t.Fatalf("check() = nil, want a %s violation", tt.wantRule)
+			}
+			if violation.Rule != tt.wantRule || violation.Path != tt.wantPath {
+				t.Errorf("check() = %s at %s, want %s at %s", violation.Rule, violation.Path, tt.wantRule, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestSearchPolicyDisabled(t *testing.T) {
+	policy := newSearchPolicy(SearchPolicyConfig{Enabled: false})
+	body := map[string]any{"script_fields": map[string]any{"x": map[string]any{"script": "1"}}}
+	if violation := policy.check(body); violation != nil {
+		t.Errorf("check() = %v, want no violation with the policy disabled", violation)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxProfileShards caps the shards of a condensed profile; the slowest
+	// are kept.
+	maxProfileShards = 10
+	// maxProfileEntries caps the entries of each section of a shard profile.
+	maxProfileEntries = 25
+	// maxProfileHotspots is the number of slowest components highlighted.
+	maxProfileHotspots = 5
+	// maxProfileDescription caps the length of a component description.
+	maxProfileDescription = 200
+)
+
+// SearchProfile is the "profile" section of a search response.
+type SearchProfile struct {
+	Shards []struct {
+		ID       string `json:"id"`
+		NodeID   string `json:"node_id"`
+		Index    string `json:"index"`
+		Searches []struct {
+			Query       []profileNode   `json:"query"`
+			RewriteTime int64           `json:"rewrite_time"`
+			Collector   []collectorNode `json:"collector"`
+		} `json:"searches"`
+		Aggregations []profileNode `json:"aggregations"`
+		Fetch        *profileNode  `json:"fetch"`
+	} `json:"shards"`
+}
+
+// profileNode is a timed query, aggregation or fetch component. Its time
+// includes the time of its children.
+type profileNode struct {
+	Type        string           `json:"type"`
+	Description string           `json:"description"`
+	TimeInNanos int64            `json:"time_in_nanos"`
+	Breakdown   map[string]int64 `json:"breakdown"`
+	Children    []profileNode    `json:"children"`
+}
+
+type collectorNode struct {
+	Name        string          `json:"name"`
+	Reason      string          `json:"reason"`
+	TimeInNanos int64           `json:"time_in_nanos"`
+	Children    []collectorNode `json:"children"`
+}
+
+// profileEntry is a component of a condensed profile. Entries are listed
+// depth first; depth gives their place in the tree.
+type profileEntry struct {
+	Depth       int     `json:"depth"`
+	Type        string  `json:"type"`
+	Description string  `json:"description,omitempty"`
+	TimeMS      float64 `json:"time_ms"`
+	// SelfMS is the time spent in the component itself, without its
+	// children.
+	SelfMS float64 `json:"self_ms"`
+	// Components holds the non-zero timings of the breakdown, in
+	// milliseconds.
+	Components map[string]float64 `json:"components,omitempty"`
+}
+
+type shardProfile struct {
+	Shard          string         `json:"shard"`
+	Index          string         `json:"index,omitempty"`
+	Node           string         `json:"node,omitempty"`
+	QueryMS        float64        `json:"query_ms"`
+	RewriteMS      float64        `json:"rewrite_ms"`
+	CollectorMS    float64        `json:"collector_ms"`
+	AggregationsMS float64        `json:"aggregations_ms"`
+	FetchMS        float64        `json:"fetch_ms"`
+	Queries        []profileEntry `json:"queries,omitempty"`
+	Collectors     []profileEntry `json:"collectors,omitempty"`
+	Aggregations   []profileEntry `json:"aggregations,omitempty"`
+	Fetch          []profileEntry `json:"fetch,omitempty"`
+	Truncated      bool           `json:"truncated,omitempty"`
+}
+
+// profileHotspot is one of the slowest components of a search, ranked by
+// the time spent in the component itself.
+type profileHotspot struct {
+	Shard            string  `json:"shard"`
+	Kind             string  `json:"kind"`
+	Type             string  `json:"type"`
+	Description      string  `json:"description,omitempty"`
+	SelfMS           float64 `json:"self_ms"`
+	SlowestComponent string  `json:"slowest_component,omitempty"`
+}
+
+type profileSummary struct {
+	ShardsProfiled int              `json:"shards_profiled"`
+	Slowest        []profileHotspot `json:"slowest"`
+	Shards         []shardProfile   `json:"shards"`
+}
+
+// summarizeProfile condenses the raw profile tree: per shard, the time of
+// each section and a flattened list of its components, plus the slowest
+// components across all shards.
+func summarizeProfile(profile *SearchProfile) *profileSummary {
+	summary := &profileSummary{Slowest: []profileHotspot{}, Shards: []shardProfile{}}
+	if profile == nil {
+		return summary
+	}
+	summary.ShardsProfiled = len(profile.Shards)
+
+	var hotspots []profileHotspot
+	for _, shard := range profile.Shards {
+		sp := shardProfile{Shard: shard.ID, Index: shard.Index, Node: shard.NodeID}
+
+		var queries, collectors []profileEntry
+		for _, search := range shard.Searches {
+			for _, node := range search.Query {
+				sp.QueryMS += nanosToMillis(node.TimeInNanos)
+			}
+			for _, node := range search.Collector {
+				sp.CollectorMS += nanosToMillis(node.TimeInNanos)
+			}
+			sp.RewriteMS += nanosToMillis(search.RewriteTime)
+			queries = flattenProfile(search.Query, 0, queries)
+			collectors = flattenCollectors(search.Collector, 0, collectors)
+		}
+		for _, node := range shard.Aggregations {
+			sp.AggregationsMS += nanosToMillis(node.TimeInNanos)
+		}
+		aggregations := flattenProfile(shard.Aggregations, 0, nil)
+		var fetch []profileEntry
+		if shard.Fetch != nil {
+			sp.FetchMS = nanosToMillis(shard.Fetch.TimeInNanos)
+			fetch = flattenProfile([]profileNode{*shard.Fetch}, 0, nil)
+		}
+
+		hotspots = appendHotspots(hotspots, shard.ID, "query", queries)
+		hotspots = appendHotspots(hotspots, shard.ID, "aggregation", aggregations)
+		hotspots = appendHotspots(hotspots, shard.ID, "fetch", fetch)
+
+		sp.Queries, sp.Truncated = capEntries(queries, sp.Truncated)
+		sp.Collectors, sp.Truncated = capEntries(collectors, sp.Truncated)
+		sp.Aggregations, sp.Truncated = capEntries(aggregations, sp.Truncated)
+		sp.Fetch, sp.Truncated = capEntries(fetch, sp.Truncated)
+
+		summary.Shards = append(summary.Shards, sp)
+	}
+
+	sort.SliceStable(summary.Shards, func(i, j int) bool {
+		a, b := summary.Shards[i], summary.Shards[j]
+		return a.QueryMS+a.AggregationsMS+a.FetchMS > b.QueryMS+b.AggregationsMS+b.FetchMS
+	})
+	if len(summary.Shards) > maxProfileShards {
+		summary.Shards = summary.Shards[:maxProfileShards]
+	}
+
+	sort.SliceStable(hotspots, func(i, j int) bool { return hotspots[i].SelfMS > hotspots[j].SelfMS })
+	if len(hotspots) > maxProfileHotspots {
+		hotspots = hotspots[:maxProfileHotspots]
+	}
+	summary.Slowest = append(summary.Slowest, hotspots...)
+
+	return summary
+}
+
+// flattenProfile appends the nodes and their children to out, depth first.
+func flattenProfile(nodes []profileNode, depth int, out []profileEntry) []profileEntry {
+	for _, node := range nodes {
+		self := node.TimeInNanos
+		for _, child := range node.Children {
+			self -= child.TimeInNanos
+		}
+
+		var components map[string]float64
+		for name, nanos := range node.Breakdown {
+			// The breakdown mixes timings with invocation counts.
+			if nanos == 0 || strings.HasSuffix(name, "_count") {
+				continue
+			}
+			if components == nil {
+				components = make(map[string]float64)
+			}
+			components[name] = nanosToMillis(nanos)
+		}
+
+		out = append(out, profileEntry{
+			Depth:       depth,
+			Type:        node.Type,
+			Description: truncateDescription(node.Description),
+			TimeMS:      nanosToMillis(node.TimeInNanos),
+			SelfMS:      nanosToMillis(max(self, 0)),
+			Components:  components,
+		})
+		out = flattenProfile(node.Children, depth+1, out)
+	}
+	return out
+}
+
+// flattenCollectors appends the collectors and their children to out, depth
+// first.
+func flattenCollectors(nodes []collectorNode, depth int, out []profileEntry) []profileEntry {
+	for _, node := range nodes {
+		self := node.TimeInNanos
+		for _, child := range node.Children {
+			self -= child.TimeInNanos
+		}
+		out = append(out, profileEntry{
+			Depth:       depth,
+			Type:        node.Name,
+			Description: node.Reason,
+			TimeMS:      nanosToMillis(node.TimeInNanos),
+			SelfMS:      nanosToMillis(max(self, 0)),
+		})
+		out = flattenCollectors(node.Children, depth+1, out)
+	}
+	return out
+}
+
+func appendHotspots(hotspots []profileHotspot, shard, kind string, entries []profileEntry) []profileHotspot {
+	for _, entry := range entries {
+		hotspot := profileHotspot{
+			Shard:       shard,
+			Kind:        kind,
+			Type:        entry.Type,
+			Description: entry.Description,
+			SelfMS:      entry.SelfMS,
+		}
+		var slowest float64
+		for name, ms := range entry.Components {
+			if ms > slowest || (ms == slowest && name < hotspot.SlowestComponent) {
+				slowest = ms
+				hotspot.SlowestComponent = name
+			}
+		}
+		hotspots = append(hotspots, hotspot)
+	}
+	return hotspots
+}
+
+// capEntries caps entries at maxProfileEntries, reporting whether entries
+// were dropped or truncated was already set.
+func capEntries(entries []profileEntry, truncated bool) ([]profileEntry, bool) {
+	if len(entries) > maxProfileEntries {
+		return entries[:maxProfileEntries], true
+	}
+	return entries, truncated
+}
+
+func truncateDescription(description string) string {
+	if len(description) <= maxProfileDescription {
+		return description
+	}
+	cut := maxProfileDescription
+	for cut > 0 && !utf8.RuneStart(description[cut]) {
+		cut--
+	}
+	return description[:cut] + "..."
+}
+
+// nanosToMillis converts nanoseconds to milliseconds, rounded to the
+// microsecond.
+func nanosToMillis(nanos int64) float64 {
+	return math.Round(float64(nanos)/1e3) / 1e3
+}
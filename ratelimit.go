@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/rs/zerolog"
+	"golang.org/x/time/rate"
+)
+
+const (
+	rateLimitScopeGlobal = "global"
+	rateLimitScopeTool   = "tool"
+	rateLimitScopeClient = "client"
+
+	// concurrencyRetryAfter is the retry hint given when a request is
+	// rejected for exceeding a max-in-flight cap, since there is no way to
+	// know when a slot frees up.
+	concurrencyRetryAfter = time.Second
+)
+
+// RateLimitConfig limits tool calls across all clients (Global), for each
+// tool across all clients (Tools) and for each client identity (PerClient).
+// A call must pass every limit that applies to it.
+type RateLimitConfig struct {
+	Global    LimitConfig            `yaml:"global"`
+	PerClient LimitConfig            `yaml:"per_client"`
+	Tools     map[string]LimitConfig `yaml:"tools,omitempty"`
+}
+
+// LimitConfig is a token bucket refilled at RequestsPerMinute holding up to
+// Burst tokens (RequestsPerMinute when zero), plus a cap on concurrent calls.
+// Zero values disable the corresponding limit.
+type LimitConfig struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	Burst             int `yaml:"burst,omitempty"`
+	MaxInFlight       int `yaml:"max_in_flight"`
+}
+
+func (cfg LimitConfig) enabled() bool {
+	return cfg.RequestsPerMinute > 0 || cfg.MaxInFlight > 0
+}
+
+func (cfg RateLimitConfig) enabled() bool {
+	if cfg.Global.enabled() || cfg.PerClient.enabled() {
+		return true
+	}
+	for _, limit := range cfg.Tools {
+		if limit.enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// RateLimitError is returned to the client when a call exceeds a limit.
+type RateLimitError struct {
+	Scope      string
+	Name       string
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	scope := e.Scope
+	if e.Name != "" {
+		scope = fmt.Sprintf("%s %q", e.Scope, e.Name)
+	}
+	return fmt.Sprintf("rate limit exceeded for %s: %s, retry after %s", scope, e.Reason, e.RetryAfter)
+}
+
+// toolResult renders the error as a structured tool error with a retry hint.
+func (e *RateLimitError) toolResult() *mcp.CallToolResult {
+	response := map[string]any{
+		"error":               "rate limit exceeded",
+		"scope":               e.Scope,
+		"reason":              e.Reason,
+		"retry_after_seconds": math.Ceil(e.RetryAfter.Seconds()),
+	}
+	if e.Name != "" {
+		response[e.Scope] = e.Name
+	}
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		return mcp.NewToolResultError(e.Error())
+	}
+	return mcp.NewToolResultError(string(jsonBytes))
+}
+
+// limiter enforces a single LimitConfig.
+type limiter struct {
+	bucket *rate.Limiter
+	slots  chan struct{}
+}
+
+func newLimiter(cfg LimitConfig) *limiter {
+	if !cfg.enabled() {
+		return nil
+	}
+
+	l := &limiter{}
+	if cfg.RequestsPerMinute > 0 {
+		burst := cfg.Burst
+		if burst <= 0 {
+			burst = cfg.RequestsPerMinute
+		}
+		l.bucket = rate.NewLimiter(rate.Limit(float64(cfg.RequestsPerMinute)/60), burst)
+	}
+	if cfg.MaxInFlight > 0 {
+		l.slots = make(chan struct{}, cfg.MaxInFlight)
+	}
+	return l
+}
+
+// permit is an admitted call. release must be called when the call is done;
+// cancel instead gives back both the concurrency slot and the token when a
+// later limit rejects the call.
+type permit struct {
+	l           *limiter
+	reservation *rate.Reservation
+}
+
+func (p permit) release() {
+	if p.l != nil && p.l.slots != nil {
+		<-p.l.slots
+	}
+}
+
+func (p permit) cancel() {
+	p.release()
+	if p.reservation != nil {
+		p.reservation.Cancel()
+	}
+}
+
+// acquire admits a call, or returns the reason it was rejected and how long
+// to wait before retrying.
+func (l *limiter) acquire(now time.Time) (permit, string, time.Duration) {
+	if l == nil {
+		return permit{}, "", 0
+	}
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			return permit{}, "too many concurrent requests", concurrencyRetryAfter
+		}
+	}
+
+	p := permit{l: l}
+	if l.bucket != nil {
+		reservation := l.bucket.ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			reservation.CancelAt(now)
+			p.release()
+			return permit{}, "too many requests", delay
+		}
+		p.reservation = reservation
+	}
+
+	return p, "", 0
+}
+
+// rateLimiter applies the global, per-tool and per-client limits to every
+// tool call.
+type rateLimiter struct {
+	global    *limiter
+	tools     map[string]*limiter
+	perClient LimitConfig
+	logger    zerolog.Logger
+
+	mu      sync.Mutex
+	clients map[string]*limiter
+}
+
+func newRateLimiter(cfg RateLimitConfig, logger zerolog.Logger) *rateLimiter {
+	rl := &rateLimiter{
+		global:    newLimiter(cfg.Global),
+		tools:     make(map[string]*limiter, len(cfg.Tools)),
+		perClient: cfg.PerClient,
+		logger:    logger.With().Str("component", "ratelimit").Logger(),
+		clients:   make(map[string]*limiter),
+	}
+	for tool, limit := range cfg.Tools {
+		rl.tools[tool] = newLimiter(limit)
+	}
+	return rl
+}
+
+func (rl *rateLimiter) clientLimiter(clientID string) *limiter {
+	if !rl.perClient.enabled() {
+		return nil
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	l, ok := rl.clients[clientID]
+	if !ok {
+		l = newLimiter(rl.perClient)
+		rl.clients[clientID] = l
+	}
+	return l
+}
+
+// acquire admits a call by client to tool against every applicable limit,
+// returning the permits to release once the call is done.
+func (rl *rateLimiter) acquire(tool, clientID string) ([]permit, *RateLimitError) {
+	scopes := []struct {
+		scope string
+		name  string
+		l     *limiter
+	}{
+		{rateLimitScopeGlobal, "", rl.global},
+		{rateLimitScopeTool, tool, rl.tools[tool]},
+		{rateLimitScopeClient, clientID, rl.clientLimiter(clientID)},
+	}
+
+	now := time.Now()
+	permits := make([]permit, 0, len(scopes))
+	for _, s := range scopes {
+		p, reason, retryAfter := s.l.acquire(now)
+		if reason != "" {
+			for _, granted := range permits {
+				granted.cancel()
+			}
+			return nil, &RateLimitError{
+				Scope:      s.scope,
+				Name:       s.name,
+				Reason:     reason,
+				RetryAfter: retryAfter,
+			}
+		}
+		permits = append(permits, p)
+	}
+
+	return permits, nil
+}
+
+// middleware rejects tool calls exceeding a limit with a tool error carrying
+// a retry-after hint.
+func (rl *rateLimiter) middleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		clientID := clientIdentityFromContext(ctx).ID
+
+		permits, limitErr := rl.acquire(request.Params.Name, clientID)
+		if limitErr != nil {
+			rl.logger.Warn().
+				Str("client_id", clientID).
+				Str("tool", request.Params.Name).
+				Str("scope", limitErr.Scope).
+				Str("reason", limitErr.Reason).
+				Dur("retry_after", limitErr.RetryAfter).
+				Msg("Tool call rate limited")
+			return limitErr.toolResult(), nil
+		}
+		defer func() {
+			for _, p := range permits {
+				p.release()
+			}
+		}()
+
+		return next(ctx, request)
+	}
+}
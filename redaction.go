@@ -0,0 +1,803 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/rs/zerolog"
+)
+
+const (
+	redactDrop    = "drop"
+	redactHash    = "hash"
+	redactMask    = "mask"
+	redactReplace = "replace"
+)
+
+type RedactionConfig struct {
+	HashSalt string          `yaml:"hash_salt,omitempty"`
+	Rules    []RedactionRule `yaml:"rules,omitempty"`
+}
+
+// RedactionRule rewrites the fields matching any of Fields in documents from
+// indices matching any of Indices (every index when empty). Field patterns
+// are dotted paths such as "user.email" or "*.token"; a pattern also covers
+// the sub-fields of the field it names.
+type RedactionRule struct {
+	Indices     []string `yaml:"indices,omitempty"`
+	Fields      []string `yaml:"fields"`
+	Action      string   `yaml:"action"`
+	Pattern     string   `yaml:"pattern,omitempty"`
+	Replacement string   `yaml:"replacement,omitempty"`
+}
+
+type redactionRule struct {
+	RedactionRule
+	re *regexp.Regexp
+}
+
+// redactor masks sensitive fields in search results before they are returned
+// to the client: in _source, highlight and fields of every hit, including
+// top_hits and inner hits, and in aggregation bucket keys.
+type redactor struct {
+	rules []*redactionRule
+	salt  []byte
+}
+
+func newRedactor(cfg RedactionConfig) (*redactor, error) {
+	r := &redactor{salt: []byte(cfg.HashSalt)}
+
+	for i, rule := range cfg.Rules {
+		if len(rule.Fields) == 0 {
+			return nil, fmt.Errorf("redaction.rules[%d].fields is required", i)
+		}
+		// Without a key, hashes of guessable values such as emails are
+		// reversed by hashing a dictionary.
+		if rule.Action == redactHash && cfg.HashSalt == "" {
+			return nil, fmt.Errorf(
+				"redaction.rules[%d] hashes values, which requires %s",
+				i, configKey("redaction.hash_salt", "MCP_ES_REDACT_HASH_SALT"),
+			)
+		}
+
+		compiled := &redactionRule{RedactionRule: rule}
+		if rule.Pattern != "" {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid redaction.rules[%d].pattern: %w", i, err)
+			}
+			compiled.re = re
+		}
+
+		switch rule.Action {
+		case redactDrop, redactHash, redactMask:
+		case redactReplace:
+			if compiled.re == nil {
+				return nil, fmt.Errorf("redaction.rules[%d].pattern is required for replace", i)
+			}
+		default:
+			return nil, fmt.Errorf(
+				"invalid redaction.rules[%d].action: %q (expected drop, hash, mask or replace)",
+				i, rule.Action,
+			)
+		}
+
+		r.rules = append(r.rules, compiled)
+	}
+
+	return r, nil
+}
+
+func (r *redactor) enabled() bool {
+	return r != nil && len(r.rules) > 0
+}
+
+// indexScoped reports whether some rule only applies to some indices, which
+// makes the names of the indices of the hits matter.
+func (r *redactor) indexScoped() bool {
+	if !r.enabled() {
+		return false
+	}
+	for _, rule := range r.rules {
+		if len(rule.Indices) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// indexNames maps concrete indices to the other names they are known by:
+// their data stream and their aliases. Rules restricted to some indices
+// apply to documents of an index under any of its names.
+type indexNames map[string][]string
+
+// redactSearchResponse redacts a search response before it is returned.
+// The data streams and aliases of the indices of the hits are resolved
+// first, so that rules naming them apply to their backing indices. It
+// returns the tool error to send back when they cannot be resolved.
+func (h *ElasticsearchHandler) redactSearchResponse(
+	ctx context.Context,
+	log zerolog.Logger,
+	c *cluster,
+	resp *SearchResponse,
+	request map[string]any,
+) *mcp.CallToolResult {
+	names, errResult := h.redactionNames(ctx, log, c, resp.Hits.Hits)
+	if errResult != nil {
+		return errResult
+	}
+	h.redactor.redactSearchResponse(resp, request, names)
+	return nil
+}
+
+// checkRedactedSources refuses a query over an index expression when a
+// redaction rule applies to one of its indices. It is used by the query
+// languages, whose columns can be computed from any field under any name and
+// so cannot be redacted field by field. It returns the tool error to send
+// back.
+func (h *ElasticsearchHandler) checkRedactedSources(
+	ctx context.Context,
+	log zerolog.Logger,
+	c *cluster,
+	index string,
+	language string,
+) *mcp.CallToolResult {
+	redacted, err := h.redactedIndex(ctx, c, index)
+	if err != nil {
+		log.Error().Err(err).Str("index", index).Msg("Failed to resolve indices for redaction")
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to resolve indices for redaction: %v", err))
+	}
+	if redacted == "" {
+		return nil
+	}
+
+	log.Warn().Str("index", redacted).Msgf("%s query refused on an index with redaction rules", language)
+	return mcp.NewToolResultError(fmt.Sprintf(
+		"Cannot run %s queries over %q: field redaction rules apply to it, and query results cannot be redacted field by field",
+		language, redacted,
+	))
+}
+
+// redactedIndex returns the first index of an index expression that a
+// redaction rule applies to, by its own name, its data stream or its
+// aliases, or "" when no rule applies to any of them.
+func (h *ElasticsearchHandler) redactedIndex(ctx context.Context, c *cluster, index string) (string, error) {
+	if !h.redactor.enabled() || index == "" {
+		return "", nil
+	}
+	if !h.redactor.indexScoped() {
+		return index, nil
+	}
+
+	names, err := c.indexNames(ctx, splitList(index))
+	if err != nil {
+		return "", err
+	}
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		if len(h.redactor.rulesFor(append([]string{name}, names[name]...)...)) > 0 {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+// redactionNames resolves the other names of the indices of hits, when a
+// rule restricted to some indices makes them matter.
+func (h *ElasticsearchHandler) redactionNames(
+	ctx context.Context,
+	log zerolog.Logger,
+	c *cluster,
+	hits []map[string]any,
+) (indexNames, *mcp.CallToolResult) {
+	if !h.redactor.indexScoped() {
+		return nil, nil
+	}
+
+	seen := make(map[string]bool)
+	var indices []string
+	for _, hit := range hits {
+		if index, ok := hit["_index"].(string); ok && index != "" && !seen[index] {
+			seen[index] = true
+			indices = append(indices, index)
+		}
+	}
+	if len(indices) == 0 {
+		return nil, nil
+	}
+
+	names, err := c.indexNames(ctx, indices)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to resolve indices for redaction")
+		return nil, mcp.NewToolResultError(fmt.Sprintf("Failed to resolve indices for redaction: %v", err))
+	}
+	return names, nil
+}
+
+// redactSearchResponse redacts the hits and aggregations of a search
+// response. request is the search body, used to find the field behind each
+// aggregation and each sort value. names holds the other names of the
+// indices of the hits.
+func (r *redactor) redactSearchResponse(resp *SearchResponse, request map[string]any, names indexNames) {
+	if !r.enabled() {
+		return
+	}
+
+	sortFields, sortKnown := sortFields(request["sort"])
+	for _, hit := range resp.Hits.Hits {
+		rules := r.hitRules(hit, names)
+		r.redactHitWith(hit, rules)
+		r.redactSortValues(hit, rules, sortFields, sortKnown)
+	}
+
+	aggs, _ := request["aggs"].(map[string]any)
+	if aggs == nil {
+		aggs, _ = request["aggregations"].(map[string]any)
+	}
+	r.redactAggregations(resp.Aggregations, aggs)
+}
+
+// redactHit redacts a single search hit in place. names holds the other
+// names of the hit's index.
+func (r *redactor) redactHit(hit map[string]any, names indexNames) {
+	r.redactHitWith(hit, r.hitRules(hit, names))
+}
+
+// hitRules returns the rules that apply to a hit, by the name of its index
+// and by its other names.
+func (r *redactor) hitRules(hit map[string]any, names indexNames) []*redactionRule {
+	index, _ := hit["_index"].(string)
+	return r.rulesFor(append([]string{index}, names[index]...)...)
+}
+
+// redactHitWith redacts a hit in place with the given rules.
+func (r *redactor) redactHitWith(hit map[string]any, rules []*redactionRule) {
+	if len(rules) == 0 {
+		return
+	}
+
+	if source, ok := hit["_source"].(map[string]any); ok {
+		r.redactObject(source, "", rules)
+	}
+	for _, key := range []string{"highlight", "fields"} {
+		if flat, ok := hit[key].(map[string]any); ok {
+			r.redactFlat(flat, rules)
+		}
+	}
+
+	// Inner hits come from the same document, and so the same index.
+	if innerHits, ok := hit["inner_hits"].(map[string]any); ok {
+		for _, inner := range innerHits {
+			r.redactHits(inner, rules)
+		}
+	}
+}
+
+// redactHits redacts a {"hits": {"hits": [...]}} object, as returned by
+// top_hits aggregations and inner hits, with the given rules.
+func (r *redactor) redactHits(value any, rules []*redactionRule) {
+	obj, _ := value.(map[string]any)
+	hits, _ := obj["hits"].(map[string]any)
+	list, _ := hits["hits"].([]any)
+	for _, item := range list {
+		if hit, ok := item.(map[string]any); ok {
+			r.redactHitWith(hit, rules)
+		}
+	}
+}
+
+// redactSortValues redacts the sort values of a hit, which repeat the values
+// of the fields sorted on. The values are dropped when they cannot all be
+// told apart, as with script sorts.
+func (r *redactor) redactSortValues(hit map[string]any, rules []*redactionRule, fields []string, known bool) {
+	values, ok := hit["sort"].([]any)
+	if !ok || len(rules) == 0 {
+		return
+	}
+	if !known || len(fields) != len(values) {
+		delete(hit, "sort")
+		return
+	}
+
+	for i, field := range fields {
+		if rule := matchRedactionRule(rules, field); rule != nil {
+			values[i] = r.applyKey(rule, values[i])
+		}
+	}
+}
+
+// sortFields returns the field behind each value of a sort specification,
+// or "" for sorts on the score or the document order. known is false when a
+// sort's field cannot be told, as with script sorts.
+func sortFields(sort any) (fields []string, known bool) {
+	var sorts []any
+	switch s := sort.(type) {
+	case nil:
+		return nil, true
+	case []any:
+		sorts = s
+	default:
+		sorts = []any{s}
+	}
+
+	for _, item := range sorts {
+		var field string
+		switch s := item.(type) {
+		case string:
+			field = s
+		case map[string]any:
+			if len(s) != 1 {
+				return nil, false
+			}
+			for key, value := range s {
+				field = key
+				if key == "_geo_distance" {
+					field = geoDistanceField(asMap(value))
+				}
+			}
+		default:
+			return nil, false
+		}
+
+		switch field {
+		case "_score", "_doc", "_shard_doc":
+			field = ""
+		case "", "_script":
+			return nil, false
+		}
+		fields = append(fields, field)
+	}
+	return fields, true
+}
+
+// geoDistanceField returns the field of a _geo_distance sort, the only key
+// of the sort that is not one of its options.
+func geoDistanceField(sort map[string]any) string {
+	var field string
+	for key := range sort {
+		switch key {
+		case "order", "unit", "mode", "distance_type", "ignore_unmapped", "nested":
+			continue
+		}
+		if field != "" {
+			return ""
+		}
+		field = key
+	}
+	return field
+}
+
+// redactObject walks a _source document, rewriting every field matched by a
+// rule.
+func (r *redactor) redactObject(obj map[string]any, prefix string, rules []*redactionRule) {
+	for key, value := range obj {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		if rule := matchRedactionRule(rules, path); rule != nil {
+			if rule.Action == redactDrop {
+				delete(obj, key)
+			} else {
+				obj[key] = r.apply(rule, value)
+			}
+			continue
+		}
+
+		switch v := value.(type) {
+		case map[string]any:
+			r.redactObject(v, path, rules)
+		case []any:
+			for _, item := range v {
+				if child, ok := item.(map[string]any); ok {
+					r.redactObject(child, path, rules)
+				}
+			}
+		}
+	}
+}
+
+// redactFlat rewrites objects keyed by full field name, such as the
+// highlight and fields sections of a hit.
+func (r *redactor) redactFlat(obj map[string]any, rules []*redactionRule) {
+	for field, value := range obj {
+		rule := matchRedactionRule(rules, field)
+		if rule == nil {
+			continue
+		}
+		if rule.Action == redactDrop {
+			delete(obj, field)
+		} else {
+			obj[field] = r.apply(rule, value)
+		}
+	}
+}
+
+// redactJoinKeys redacts the join keys of an EQL sequence, given the fields
+// behind each key. Sequences may join documents of any index, so every rule
+// applies regardless of its indices. When the keys cannot be matched to
+// their fields, they are dropped altogether.
+func (r *redactor) redactJoinKeys(keys []any, fields [][]string) []any {
+	if !r.enabled() || len(keys) == 0 {
+		return keys
+	}
+	if len(fields) != len(keys) {
+		return nil
+	}
+
+	redacted := make([]any, len(keys))
+	for i, key := range keys {
+		redacted[i] = key
+		for _, field := range fields[i] {
+			if rule := matchRedactionRule(r.rules, field); rule != nil {
+				redacted[i] = r.applyKey(rule, key)
+				break
+			}
+		}
+	}
+	return redacted
+}
+
+// redactAggregations rewrites the bucket keys of aggregations over redacted
+// fields, the values of metric aggregations over them, and top_hits.
+// Documents of any index can feed an aggregation, so every rule applies
+// regardless of its indices.
+func (r *redactor) redactAggregations(result map[string]any, request map[string]any) {
+	for name, def := range request {
+		agg, ok := result[name].(map[string]any)
+		if !ok {
+			continue
+		}
+		body, _ := def.(map[string]any)
+
+		fields := aggregationKeyFields(body)
+
+		if _, ok := body["top_hits"]; ok {
+			r.redactHits(agg, r.rules)
+		}
+		if params, ok := body["top_metrics"].(map[string]any); ok {
+			r.redactTopMetrics(agg, params)
+		}
+		for aggType, params := range body {
+			if metricAggregations[aggType] {
+				r.redactMetric(agg, asMap(params))
+			}
+		}
+		if afterKey, ok := agg["after_key"].(map[string]any); ok {
+			r.redactKeyObject(afterKey, fields)
+		}
+
+		subAggs, _ := body["aggs"].(map[string]any)
+		if subAggs == nil {
+			subAggs, _ = body["aggregations"].(map[string]any)
+		}
+
+		switch buckets := agg["buckets"].(type) {
+		case []any:
+			for _, item := range buckets {
+				if bucket, ok := item.(map[string]any); ok {
+					r.redactBucketKey(bucket, fields)
+					r.redactAggregations(bucket, subAggs)
+				}
+			}
+		case map[string]any:
+			for _, item := range buckets {
+				if bucket, ok := item.(map[string]any); ok {
+					r.redactAggregations(bucket, subAggs)
+				}
+			}
+		}
+
+		// Single bucket aggregations (filter, nested, ...) hold their
+		// sub-aggregations directly.
+		r.redactAggregations(agg, subAggs)
+	}
+}
+
+// metricAggregations are the aggregations whose results are computed from
+// the values of their fields, such as their minimum, maximum or average.
+var metricAggregations = map[string]bool{
+	"avg":                       true,
+	"sum":                       true,
+	"min":                       true,
+	"max":                       true,
+	"stats":                     true,
+	"extended_stats":            true,
+	"percentiles":               true,
+	"percentile_ranks":          true,
+	"median_absolute_deviation": true,
+	"boxplot":                   true,
+	"string_stats":              true,
+	"geo_bounds":                true,
+	"geo_centroid":              true,
+	"geo_line":                  true,
+	"weighted_avg":              true,
+	"rate":                      true,
+	"matrix_stats":              true,
+}
+
+// metricCountKeys are the parts of a metric aggregation result that count
+// documents rather than reveal values.
+var metricCountKeys = map[string]bool{"count": true, "doc_count": true, "meta": true}
+
+// redactMetric rewrites the result of a metric aggregation when any field it
+// reads is redacted. Metric results have no buckets, so all their values
+// come from those fields.
+func (r *redactor) redactMetric(agg map[string]any, params map[string]any) {
+	var rule *redactionRule
+	for _, field := range metricFields(params) {
+		if rule = matchRedactionRule(r.rules, field); rule != nil {
+			break
+		}
+	}
+	if rule == nil {
+		return
+	}
+
+	for key, value := range agg {
+		if metricCountKeys[key] {
+			continue
+		}
+		if rule.Action == redactDrop {
+			delete(agg, key)
+		} else {
+			agg[key] = r.apply(rule, value)
+		}
+	}
+}
+
+// metricFields returns the fields a metric aggregation reads: its field, the
+// value and weight fields of weighted_avg, or the fields of matrix_stats.
+func metricFields(params map[string]any) []string {
+	var fields []string
+	if field, ok := params["field"].(string); ok {
+		fields = append(fields, field)
+	}
+	for _, key := range []string{"value", "weight", "point"} {
+		if field, ok := asMap(params[key])["field"].(string); ok {
+			fields = append(fields, field)
+		}
+	}
+	if list, ok := params["fields"].([]any); ok {
+		for _, item := range list {
+			if field, ok := item.(string); ok {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
+
+// redactTopMetrics rewrites the metrics of a top_metrics aggregation that
+// come from redacted fields, and its sort values when it sorts on one.
+func (r *redactor) redactTopMetrics(agg map[string]any, params map[string]any) {
+	sortFields, sortKnown := sortFields(params["sort"])
+	top, _ := agg["top"].([]any)
+	for _, item := range top {
+		entry, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		if metrics, ok := entry["metrics"].(map[string]any); ok {
+			r.redactFlat(metrics, r.rules)
+		}
+		r.redactSortValues(entry, r.rules, sortFields, sortKnown)
+	}
+}
+
+// aggregationKeyFields returns the fields that make up the bucket keys of an
+// aggregation: the field of a terms-like aggregation, the fields of a
+// multi_terms aggregation by position, or the fields of the sources of a
+// composite aggregation by source name.
+func aggregationKeyFields(body map[string]any) map[string]string {
+	fields := make(map[string]string)
+	for aggType, v := range body {
+		params, _ := v.(map[string]any)
+		switch aggType {
+		case "multi_terms":
+			terms, _ := params["terms"].([]any)
+			for i, term := range terms {
+				if t, ok := term.(map[string]any); ok {
+					if field, ok := t["field"].(string); ok {
+						fields[strconv.Itoa(i)] = field
+					}
+				}
+			}
+		case "composite":
+			sources, _ := params["sources"].([]any)
+			for _, source := range sources {
+				named, _ := source.(map[string]any)
+				for name, def := range named {
+					for _, sourceParams := range asMap(def) {
+						if field, ok := asMap(sourceParams)["field"].(string); ok {
+							fields[name] = field
+						}
+					}
+				}
+			}
+		default:
+			if field, ok := params["field"].(string); ok {
+				fields[""] = field
+			}
+		}
+	}
+	return fields
+}
+
+// redactBucketKey rewrites the key (and key_as_string) of a bucket whose key
+// comes from a redacted field.
+func (r *redactor) redactBucketKey(bucket map[string]any, fields map[string]string) {
+	switch k := bucket["key"].(type) {
+	case map[string]any:
+		r.redactKeyObject(k, fields)
+		return
+	case []any:
+		for i := range k {
+			rule := matchRedactionRule(r.rules, fields[strconv.Itoa(i)])
+			if rule != nil {
+				k[i] = r.applyKey(rule, k[i])
+			}
+		}
+		if r.anyKeyRule(fields) != nil {
+			delete(bucket, "key_as_string")
+		}
+		return
+	}
+
+	rule := matchRedactionRule(r.rules, fields[""])
+	if rule == nil {
+		return
+	}
+	if rule.Action == redactDrop {
+		delete(bucket, "key")
+		delete(bucket, "key_as_string")
+		return
+	}
+	bucket["key"] = r.apply(rule, bucket["key"])
+	if s, ok := bucket["key_as_string"]; ok {
+		bucket["key_as_string"] = r.apply(rule, s)
+	}
+}
+
+// redactKeyObject rewrites a composite key, keyed by source name.
+func (r *redactor) redactKeyObject(key map[string]any, fields map[string]string) {
+	for name, value := range key {
+		if rule := matchRedactionRule(r.rules, fields[name]); rule != nil {
+			key[name] = r.applyKey(rule, value)
+		}
+	}
+}
+
+func (r *redactor) anyKeyRule(fields map[string]string) *redactionRule {
+	for _, field := range fields {
+		if rule := matchRedactionRule(r.rules, field); rule != nil {
+			return rule
+		}
+	}
+	return nil
+}
+
+// applyKey rewrites one part of a compound bucket key. Parts cannot be
+// removed without breaking the key, so dropped parts become null.
+func (r *redactor) applyKey(rule *redactionRule, value any) any {
+	if rule.Action == redactDrop {
+		return nil
+	}
+	return r.apply(rule, value)
+}
+
+// apply rewrites a value according to rule. Objects and arrays are rewritten
+// leaf by leaf; scalars become strings.
+func (r *redactor) apply(rule *redactionRule, value any) any {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, child := range v {
+			out[key] = r.apply(rule, child)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, child := range v {
+			out[i] = r.apply(rule, child)
+		}
+		return out
+	}
+
+	s := scalarString(value)
+	switch rule.Action {
+	case redactHash:
+		mac := hmac.New(sha256.New, r.salt)
+		mac.Write([]byte(s))
+		return "hash:" + hex.EncodeToString(mac.Sum(nil))[:24]
+	case redactMask:
+		if rule.re != nil {
+			return rule.re.ReplaceAllStringFunc(s, maskString)
+		}
+		return maskString(s)
+	case redactReplace:
+		return rule.re.ReplaceAllString(s, rule.Replacement)
+	default:
+		return nil
+	}
+}
+
+// rulesFor returns the rules that apply to documents of an index known by
+// any of names: its own name, its data stream or its aliases.
+func (r *redactor) rulesFor(names ...string) []*redactionRule {
+	var rules []*redactionRule
+	for _, rule := range r.rules {
+		if len(rule.Indices) == 0 || matchesAny(rule.Indices, names) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// matchesAny reports whether any of names matches any of patterns.
+func matchesAny(patterns, names []string) bool {
+	for _, pattern := range patterns {
+		for _, name := range names {
+			if globMatch(pattern, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchRedactionRule returns the first rule with a field pattern matching
+// field or one of its parent fields, so that "user" also covers
+// "user.email" and "email" covers the "email.keyword" multi-field.
+func matchRedactionRule(rules []*redactionRule, field string) *redactionRule {
+	if field == "" {
+		return nil
+	}
+	for _, rule := range rules {
+		for _, pattern := range rule.Fields {
+			for path := field; ; {
+				if globMatch(pattern, path) {
+					return rule
+				}
+				i := strings.LastIndex(path, ".")
+				if i < 0 {
+					break
+				}
+				path = path[:i]
+			}
+		}
+	}
+	return nil
+}
+
+func maskString(s string) string {
+	return strings.Repeat("*", utf8.RuneCountInString(s))
+}
+
+func scalarString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func asMap(value any) map[string]any {
+	m, _ := value.(map[string]any)
+	return m
+}
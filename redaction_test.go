@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustRedactor(t *testing.T, cfg RedactionConfig) *redactor {
+	t.Helper()
+	r, err := newRedactor(cfg)
+	if err != nil {
+		t.Fatalf("newRedactor() error = %v", err)
+	}
+	return r
+}
+
+func decodeJSON(t *testing.T, s string) map[string]any {
+	t.Helper()
+	var m map[string]any
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatalf("invalid test JSON: %v", err)
+	}
+	return m
+}
+
+func TestNewRedactor(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     RedactionConfig
+		wantErr string
+	}{
+		{
+			name: "mask rule",
+			cfg:  RedactionConfig{Rules: []RedactionRule{{Fields: []string{"email"}, Action: redactMask}}},
+		},
+		{
+			name:    "hash without salt",
+			cfg:     RedactionConfig{Rules: []RedactionRule{{Fields: []string{"email"}, Action: redactHash}}},
+			wantErr: "redaction.hash_salt",
+		},
+		{
+			name: "hash with salt",
+			cfg: RedactionConfig{
+				HashSalt: "secret",
+				Rules:    []RedactionRule{{Fields: []string{"email"}, Action: redactHash}},
+			},
+		},
+		{
+			name:    "replace without pattern",
+			cfg:     RedactionConfig{Rules: []RedactionRule{{Fields: []string{"message"}, Action: redactReplace}}},
+			wantErr: "pattern is required",
+		},
+		{
+			name:    "no fields",
+			cfg:     RedactionConfig{Rules: []RedactionRule{{Action: redactDrop}}},
+			wantErr: "fields is required",
+		},
+		{
+			name:    "unknown action",
+			cfg:     RedactionConfig{Rules: []RedactionRule{{Fields: []string{"email"}, Action: "encrypt"}}},
+			wantErr: "invalid redaction.rules[0].action",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newRedactor(tt.cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("newRedactor() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("newRedactor() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedactHits(t *testing.T) {
+	r := mustRedactor(t, RedactionConfig{
+		HashSalt: "secret",
+		Rules: []RedactionRule{
+			{Fields: []string{"password"}, Action: redactDrop},
+			{Indices: []string{"users-*"}, Fields: []string{"email"}, Action: redactMask},
+			{Indices: []string{"logs"}, Fields: []string{"user.name"}, Action: redactHash},
+		},
+	})
+
+	tests := []struct {
+		name  string
+		hit   string
+		names indexNames
+		want  string
+	}{
+		{
+			name: "source, highlight and fields",
+			hit: `{"_index": "users-1", "_source": {"email": "ab@c", "password": "x", "name": "Ann"},
+				"highlight": {"email": ["<em>ab</em>@c"]}, "fields": {"email.keyword": ["ab@c"]}}`,
+			want: `{"_index": "users-1", "_source": {"email": "****", "name": "Ann"},
+				"highlight": {"email": ["*************"]}, "fields": {"email.keyword": ["****"]}}`,
+		},
+		{
+			name: "rule restricted to other indices",
+			hit:  `{"_index": "orders", "_source": {"email": "ab@c", "password": "x"}}`,
+			want: `{"_index": "orders", "_source": {"email": "ab@c"}}`,
+		},
+		{
+			name:  "backing index of a data stream",
+			hit:   `{"_index": ".ds-users-stream-2024.01.01-000001", "_source": {"email": "ab@c"}}`,
+			names: indexNames{".ds-users-stream-2024.01.01-000001": {"users-stream"}},
+			want:  `{"_index": ".ds-users-stream-2024.01.01-000001", "_source": {"email": "****"}}`,
+		},
+		{
+			name:  "index behind an alias",
+			hit:   `{"_index": "users-v2-000001", "_source": {"email": "ab@c"}}`,
+			names: indexNames{"users-v2-000001": {"users-current"}},
+			want:  `{"_index": "users-v2-000001", "_source": {"email": "****"}}`,
+		},
+		{
+			name: "nested objects and arrays",
+			hit:  `{"_index": "users-1", "_source": {"contacts": [{"email": "a@b"}, {"email": "cd@e"}]}}`,
+			want: `{"_index": "users-1", "_source": {"contacts": [{"email": "a@b"}, {"email": "cd@e"}]}}`,
+		},
+		{
+			name: "inner hits",
+			hit: `{"_index": "users-1", "_source": {},
+				"inner_hits": {"c": {"hits": {"hits": [{"_index": "users-1", "_source": {"email": "ab@c"}}]}}}}`,
+			want: `{"_index": "users-1", "_source": {},
+				"inner_hits": {"c": {"hits": {"hits": [{"_index": "users-1", "_source": {"email": "****"}}]}}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hit := decodeJSON(t, tt.hit)
+			r.redactHit(hit, tt.names)
+			if want := decodeJSON(t, tt.want); !reflect.DeepEqual(hit, want) {
+				t.Errorf("redactHit() = %v, want %v", hit, want)
+			}
+		})
+	}
+
+	hit := decodeJSON(t, `{"_index": "logs", "_source": {"user": {"name": "ann"}}}`)
+	r.redactHit(hit, nil)
+	name, _ := asMap(asMap(hit["_source"])["user"])["name"].(string)
+	if !strings.HasPrefix(name, "hash:") || strings.Contains(name, "ann") {
+		t.Errorf("hashed user.name = %q", name)
+	}
+}
+
+func TestRedactSearchResponse(t *testing.T) {
+	r := mustRedactor(t, RedactionConfig{
+		Rules: []RedactionRule{
+			{Fields: []string{"email"}, Action: redactMask},
+			{Fields: []string{"salary"}, Action: redactDrop},
+		},
+	})
+
+	tests := []struct {
+		name    string
+		request string
+		resp    string
+		want    string
+	}{
+		{
+			name:    "sort values of redacted fields",
+			request: `{"sort": [{"email": "asc"}, "_score", {"_shard_doc": "asc"}]}`,
+			resp:    `{"hits": {"hits": [{"_index": "users", "_source": {}, "sort": ["ab@c", 1.5, 7]}]}}`,
+			want:    `{"hits": {"hits": [{"_index": "users", "_source": {}, "sort": ["****", 1.5, 7]}]}}`,
+		},
+		{
+			name:    "sort values of a script sort",
+			request: `{"sort": [{"_script": {"type": "string"}}]}`,
+			resp:    `{"hits": {"hits": [{"_index": "users", "_source": {}, "sort": ["ab@c"]}]}}`,
+			want:    `{"hits": {"hits": [{"_index": "users", "_source": {}}]}}`,
+		},
+		{
+			name:    "sort values of a geo distance sort",
+			request: `{"sort": [{"_geo_distance": {"home": [0, 0], "unit": "km"}}]}`,
+			resp:    `{"hits": {"hits": [{"_index": "users", "_source": {}, "sort": [12.5]}]}}`,
+			want:    `{"hits": {"hits": [{"_index": "users", "_source": {}, "sort": [12.5]}]}}`,
+		},
+		{
+			name:    "terms bucket keys",
+			request: `{"aggs": {"by_email": {"terms": {"field": "email.keyword"}}}}`,
+			resp:    `{"hits": {"hits": []}, "aggregations": {"by_email": {"buckets": [{"key": "ab@c", "doc_count": 2}]}}}`,
+			want:    `{"hits": {"hits": []}, "aggregations": {"by_email": {"buckets": [{"key": "****", "doc_count": 2}]}}}`,
+		},
+		{
+			name: "composite keys",
+			request: `{"aggs": {"c": {"composite": {"sources": [
+				{"e": {"terms": {"field": "email"}}}, {"d": {"terms": {"field": "day"}}}]}}}}`,
+			resp: `{"hits": {"hits": []}, "aggregations": {"c": {"after_key": {"e": "ab@c", "d": 1},
+				"buckets": [{"key": {"e": "ab@c", "d": 1}, "doc_count": 1}]}}}`,
+			want: `{"hits": {"hits": []}, "aggregations": {"c": {"after_key": {"e": "****", "d": 1},
+				"buckets": [{"key": {"e": "****", "d": 1}, "doc_count": 1}]}}}`,
+		},
+		{
+			name:    "multi_terms keys",
+			request: `{"aggs": {"m": {"multi_terms": {"terms": [{"field": "day"}, {"field": "email"}]}}}}`,
+			resp: `{"hits": {"hits": []}, "aggregations": {"m": {"buckets": [
+				{"key": [1, "ab@c"], "key_as_string": "1|ab@c", "doc_count": 1}]}}}`,
+			want: `{"hits": {"hits": []}, "aggregations": {"m": {"buckets": [
+				{"key": [1, "****"], "doc_count": 1}]}}}`,
+		},
+		{
+			name:    "metric values",
+			request: `{"aggs": {"avg_salary": {"avg": {"field": "salary"}}, "longest": {"string_stats": {"field": "email"}}}}`,
+			resp: `{"hits": {"hits": []}, "aggregations": {
+				"avg_salary": {"value": 5000, "value_as_string": "5000"},
+				"longest": {"count": 3, "min_length": 4, "max_length": 4}}}`,
+			want: `{"hits": {"hits": []}, "aggregations": {
+				"avg_salary": {},
+				"longest": {"count": 3, "min_length": "*", "max_length": "*"}}}`,
+		},
+		{
+			name:    "top_metrics",
+			request: `{"aggs": {"t": {"top_metrics": {"metrics": [{"field": "email"}, {"field": "day"}], "sort": {"salary": "desc"}}}}}`,
+			resp: `{"hits": {"hits": []}, "aggregations": {"t": {"top": [
+				{"sort": [9000], "metrics": {"email": "ab@c", "day": 3}}]}}}`,
+			want: `{"hits": {"hits": []}, "aggregations": {"t": {"top": [
+				{"sort": [null], "metrics": {"email": "****", "day": 3}}]}}}`,
+		},
+		{
+			name:    "top_hits under buckets",
+			request: `{"aggs": {"by_day": {"terms": {"field": "day"}, "aggs": {"latest": {"top_hits": {}}}}}}`,
+			resp: `{"hits": {"hits": []}, "aggregations": {"by_day": {"buckets": [{"key": 1, "doc_count": 1,
+				"latest": {"hits": {"hits": [{"_index": "users", "_source": {"email": "ab@c"}}]}}}]}}}`,
+			want: `{"hits": {"hits": []}, "aggregations": {"by_day": {"buckets": [{"key": 1, "doc_count": 1,
+				"latest": {"hits": {"hits": [{"_index": "users", "_source": {"email": "****"}}]}}}]}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp, want SearchResponse
+			if err := json.Unmarshal([]byte(tt.resp), &resp); err != nil {
+				t.Fatalf("invalid test response: %v", err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatalf("invalid test response: %v", err)
+			}
+
+			r.redactSearchResponse(&resp, decodeJSON(t, tt.request), nil)
+
+			if !reflect.DeepEqual(resp, want) {
+				got, _ := json.Marshal(resp)
+				wanted, _ := json.Marshal(want)
+				t.Errorf("redactSearchResponse() = %s, want %s", got, wanted)
+			}
+		})
+	}
+}
+
+func TestSortFields(t *testing.T) {
+	tests := []struct {
+		sort      string
+		want      []string
+		wantKnown bool
+	}{
+		{sort: `null`, wantKnown: true},
+		{sort: `"timestamp"`, want: []string{"timestamp"}, wantKnown: true},
+		{sort: `[{"email": {"order": "asc"}}, "_score", "_doc"]`, want: []string{"email", "", ""}, wantKnown: true},
+		{sort: `{"_geo_distance": {"home": "0,0", "order": "asc"}}`, want: []string{"home"}, wantKnown: true},
+		{sort: `[{"_script": {"type": "number"}}]`},
+	}
+
+	for _, tt := range tests {
+		var sort any
+		if err := json.Unmarshal([]byte(tt.sort), &sort); err != nil {
+			t.Fatalf("invalid test sort: %v", err)
+		}
+		got, known := sortFields(sort)
+		if known != tt.wantKnown || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sortFields(%s) = %v, %v, want %v, %v", tt.sort, got, known, tt.want, tt.wantKnown)
+		}
+	}
+}
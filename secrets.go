@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// SecretResolver turns a secret reference into the secret value.
+type SecretResolver interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// secretResolvers maps the suffix of a secret environment variable to the
+// resolver for its value: ES_PASSWORD_FILE holds a path to read, while
+// ES_PASSWORD_CMD holds a command whose output is the password.
+var secretResolvers = []struct {
+	suffix   string
+	resolver SecretResolver
+}{
+	{suffix: "_FILE", resolver: fileSecretResolver{}},
+	{suffix: "_CMD", resolver: execSecretResolver{timeout: 30 * time.Second}},
+}
+
+// getSecretEnv returns the secret stored in key, or resolved from one of its
+// reference variants (key_FILE, key_CMD). Setting more than one of them is
+// an error.
+func getSecretEnv(key string) (string, error) {
+	value := os.Getenv(key)
+	source := key
+
+	for _, r := range secretResolvers {
+		ref := os.Getenv(key + r.suffix)
+		if ref == "" {
+			continue
+		}
+		if source != key || value != "" {
+			return "", fmt.Errorf("%s and %s are mutually exclusive", source, key+r.suffix)
+		}
+
+		resolved, err := r.resolver.Resolve(context.Background(), ref)
+		if err != nil {
+			return "", fmt.Errorf("error resolving %s: %w", key+r.suffix, err)
+		}
+		if resolved == "" {
+			return "", fmt.Errorf("%s resolved to an empty secret", key+r.suffix)
+		}
+		value, source = resolved, key+r.suffix
+	}
+
+	return value, nil
+}
+
+// secretField binds a secret environment variable to the configuration field
+// it populates.
+type secretField struct {
+	key string
+	dst *string
+}
+
+// loadSecrets overrides each field whose secret variable, or one of its
+// reference variants, is set.
+func loadSecrets(fields ...secretField) error {
+	for _, field := range fields {
+		value, err := getSecretEnv(field.key)
+		if err != nil {
+			return err
+		}
+		if value != "" {
+			*field.dst = value
+		}
+	}
+	return nil
+}
+
+// fileSecretResolver reads secrets from files, following the Docker and
+// Kubernetes secrets convention. A single trailing newline is stripped.
+type fileSecretResolver struct{}
+
+func (fileSecretResolver) Resolve(_ context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return trimTrailingNewline(string(data)), nil
+}
+
+// execSecretResolver runs a shell command, e.g. a password manager or vault
+// CLI, and uses its standard output as the secret.
+type execSecretResolver struct {
+	timeout time.Duration
+}
+
+func (r execSecretResolver) Resolve(ctx context.Context, command string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("command failed: %w: %s", err, msg)
+		}
+		return "", fmt.Errorf("command failed: %w", err)
+	}
+
+	return trimTrailingNewline(stdout.String()), nil
+}
+
+func trimTrailingNewline(s string) string {
+	s = strings.TrimSuffix(s, "\n")
+	return strings.TrimSuffix(s, "\r")
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// SemanticConfig configures searches by text over embedding fields.
+type SemanticConfig struct {
+	// InferenceID is the inference endpoint or trained model that embeds
+	// the search text for dense_vector, sparse_vector and rank_features
+	// fields. semantic_text fields name their own endpoint in the mapping.
+	InferenceID string `yaml:"inference_id"`
+}
+
+// semanticFieldTypes are the field types a text can be searched on
+// semantically, with the query used for each.
+var semanticFieldTypes = map[string]string{
+	"semantic_text": "semantic",
+	"dense_vector":  "knn",
+	"sparse_vector": "sparse_vector",
+	"rank_features": "text_expansion",
+}
+
+// semanticFields returns the fields of the indices of the expression that
+// can be searched semantically, with their type. Fields under nested
+// objects are left out, as they need a nested query.
+func (c *cluster) semanticFields(ctx context.Context, index string) (map[string]string, error) {
+	res, err := c.client.Indices.GetMapping(
+		c.client.Indices.GetMapping.WithContext(ctx),
+		c.client.Indices.GetMapping.WithIndex(index),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var response map[string]struct {
+		Mappings map[string]any `json:"mappings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	fields := make(map[string]string)
+	for _, name := range sortedKeys(response) {
+		if err := collectSemanticFields(asMap(response[name].Mappings["properties"]), "", fields); err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// collectSemanticFields adds the semantic fields of a mapping's properties
+// to fields, descending into objects and multi-fields.
+func collectSemanticFields(properties map[string]any, prefix string, fields map[string]string) error {
+	for name, def := range properties {
+		mapping := asMap(def)
+		path := prefix + name
+		fieldType, _ := mapping["type"].(string)
+		if _, ok := semanticFieldTypes[fieldType]; ok {
+			if other, ok := fields[path]; ok && other != fieldType {
+				return fmt.Errorf("field %q is a %s field in some indices and a %s field in others", path, other, fieldType)
+			}
+			fields[path] = fieldType
+		}
+		if fieldType == "nested" {
+			continue
+		}
+		if err := collectSemanticFields(asMap(mapping["properties"]), path+".", fields); err != nil {
+			return err
+		}
+		if err := collectSemanticFields(asMap(mapping["fields"]), path+".", fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// semanticField picks the field to search: the one asked for, or the only
+// semantic field of the indices. It returns the field and its type.
+func (c *cluster) semanticField(ctx context.Context, index, field string) (string, string, error) {
+	fields, err := c.semanticFields(ctx, index)
+	if err != nil {
+		return "", "", err
+	}
+
+	if field != "" {
+		fieldType, ok := fields[field]
+		if !ok {
+			return "", "", fmt.Errorf(
+				"field %q of %q is not a semantic_text, dense_vector, sparse_vector or rank_features field",
+				field, index,
+			)
+		}
+		return field, fieldType, nil
+	}
+
+	switch len(fields) {
+	case 0:
+		return "", "", fmt.Errorf(
+			"%q has no semantic_text, dense_vector, sparse_vector or rank_features field to search", index,
+		)
+	case 1:
+		for field, fieldType := range fields {
+			return field, fieldType, nil
+		}
+	}
+
+	candidates := make([]string, 0, len(fields))
+	for _, name := range sortedKeys(fields) {
+		candidates = append(candidates, fmt.Sprintf("%s (%s)", name, fields[name]))
+	}
+	return "", "", fmt.Errorf(
+		"%q has several fields to search, pick one with 'field': %s", index, strings.Join(candidates, ", "),
+	)
+}
+
+// semanticSearchBody builds the search body that embeds text with the
+// inference endpoint and searches field with it.
+func semanticSearchBody(
+	field, fieldType, text, inferenceID string,
+	k, numCandidates int,
+	filter map[string]any,
+) (map[string]any, error) {
+	body := map[string]any{"size": k}
+
+	// The field's own value is left out of the hits: it holds embeddings,
+	// or for semantic_text fields the text next to its embeddings.
+	excludes := []string{field}
+	if fieldType == "semantic_text" {
+		excludes = []string{field + ".inference"}
+	}
+	body["_source"] = map[string]any{"excludes": excludes}
+
+	if fieldType != "semantic_text" && inferenceID == "" {
+		return nil, fmt.Errorf(
+			"searching the %s field %q needs an inference endpoint: pass 'inference_id' or set %s",
+			fieldType, field, configKey("semantic.inference_id", "MCP_ES_SEMANTIC_INFERENCE_ID"),
+		)
+	}
+
+	var query map[string]any
+	switch fieldType {
+	case "semantic_text":
+		query = map[string]any{"semantic": map[string]any{"field": field, "query": text}}
+	case "sparse_vector":
+		query = map[string]any{
+			"sparse_vector": map[string]any{"field": field, "inference_id": inferenceID, "query": text},
+		}
+	case "rank_features":
+		query = map[string]any{
+			"text_expansion": map[string]any{field: map[string]any{"model_id": inferenceID, "model_text": text}},
+		}
+	case "dense_vector":
+		knn := map[string]any{
+			"field":          field,
+			"k":              k,
+			"num_candidates": numCandidates,
+			"query_vector_builder": map[string]any{
+				"text_embedding": map[string]any{"model_id": inferenceID, "model_text": text},
+			},
+		}
+		if filter != nil {
+			knn["filter"] = filter
+		}
+		body["knn"] = knn
+		return body, nil
+	default:
+		return nil, errors.New("unsupported field type " + fieldType)
+	}
+
+	if filter != nil {
+		query = map[string]any{"bool": map[string]any{"must": query, "filter": filter}}
+	}
+	body["query"] = query
+	return body, nil
+}
+
+func (h *ElasticsearchHandler) handleSemanticSearch(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+
+	index, err := request.RequireString("index")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing index parameter")
+		return mcp.NewToolResultError("Missing 'index' parameter"), nil
+	}
+	text, err := request.RequireString("text")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing text parameter")
+		return mcp.NewToolResultError("Missing 'text' parameter"), nil
+	}
+
+	c, err := h.clusterFor(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, budget, err := h.queryBudget(ctx, "semantic_search", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
+	k := request.GetInt("k", 10)
+	if k <= 0 || k > maxKNNCandidates {
+		return mcp.NewToolResultError(fmt.Sprintf("k must be between 1 and %d", maxKNNCandidates)), nil
+	}
+	numCandidates := request.GetInt("num_candidates", min(max(k*10, 100), maxKNNCandidates))
+	if numCandidates < k || numCandidates > maxKNNCandidates {
+		return mcp.NewToolResultError(
+			fmt.Sprintf("num_candidates must be between k and %d", maxKNNCandidates),
+		), nil
+	}
+	inferenceID := request.GetString("inference_id", h.semantic.InferenceID)
+
+	log.Info().
+		Str("index", index).
+		Str("text", text).
+		Str("field", request.GetString("field", "")).
+		Int("k", k).
+		Msg("Executing semantic search")
+
+	var filter map[string]any
+	if filterString := request.GetString("filter", ""); filterString != "" {
+		if err := json.Unmarshal([]byte(filterString), &filter); err != nil {
+			log.Error().Err(err).Str("filter", filterString).Msg("Invalid filter JSON")
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid filter JSON: %v", err)), nil
+		}
+		// The filter of a kNN search is not part of the top-level query the
+		// policy inspects.
+		if violation := h.policy.check(map[string]any{"query": filter}); violation != nil {
+			log.Warn().
+				Str("index", index).
+				Str("rule", violation.Rule).
+				Str("path", violation.Path).
+				Msg("Semantic search rejected by policy")
+			return violation.toolResult(), nil
+		}
+	}
+
+	if result := h.checkIndexAccess(ctx, log, c, index); result != nil {
+		return result, nil
+	}
+
+	field, fieldType, err := c.semanticField(ctx, index, request.GetString("field", ""))
+	if err != nil {
+		log.Warn().Err(err).Str("index", index).Msg("No field to search semantically")
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	searchRequest, err := semanticSearchBody(field, fieldType, text, inferenceID, k, numCandidates, filter)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if violation := h.policy.check(searchRequest); violation != nil {
+		log.Warn().
+			Str("index", index).
+			Str("rule", violation.Rule).
+			Str("path", violation.Path).
+			Msg("Semantic search rejected by policy")
+		return violation.toolResult(), nil
+	}
+
+	searchResponse, errResult := h.executeSearch(ctx, log, c, index, searchRequest, budget, true)
+	if errResult != nil {
+		return errResult, nil
+	}
+
+	if errResult := h.redactSearchResponse(ctx, log, c, searchResponse, searchRequest); errResult != nil {
+		return errResult, nil
+	}
+
+	response := searchResult(c, index, searchResponse, budget)
+	response["field"] = field
+	response["field_type"] = fieldType
+	response["query_type"] = semanticFieldTypes[fieldType]
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal semantic search response")
+		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+	}
+
+	log.Info().
+		Str("index", index).
+		Str("field", field).
+		Str("field_type", fieldType).
+		Int("returned_hits", len(searchResponse.Hits.Hits)).
+		Int("took_ms", searchResponse.Took).
+		Msg("Semantic search executed successfully")
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/rs/zerolog"
+)
+
+// SQLConfig configures the sql tool.
+type SQLConfig struct {
+	// MaxFetchSize caps the rows returned per page. Callers may ask for
+	// smaller pages with the tool's fetch_size argument.
+	MaxFetchSize int `yaml:"max_fetch_size"`
+}
+
+type SQLResponse struct {
+	Columns []tableColumn `json:"columns"`
+	Rows    [][]any       `json:"rows"`
+	Cursor  string        `json:"cursor"`
+}
+
+// sqlCursor is an open Elasticsearch SQL cursor. Only the first page of an
+// SQL result describes its columns, so they are kept for the later pages.
+type sqlCursor struct {
+	id       string
+	clientID string
+	cluster  string
+	index    string
+	esCursor string
+	columns  []tableColumn
+	expires  time.Time
+}
+
+// sqlCursorStore holds the open SQL cursors. Like search cursors, they are
+// only usable by the client that opened them and are taken out of the store
+// while their next page is fetched.
+type sqlCursorStore struct {
+	cfg PaginationConfig
+
+	mu      sync.Mutex
+	cursors map[string]*sqlCursor
+}
+
+func newSQLCursorStore(cfg PaginationConfig) *sqlCursorStore {
+	return &sqlCursorStore{cfg: cfg, cursors: make(map[string]*sqlCursor)}
+}
+
+func (s *sqlCursorStore) take(id, clientID string) (*sqlCursor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cursor, ok := s.cursors[id]
+	if !ok || cursor.clientID != clientID || time.Now().After(cursor.expires) {
+		return nil, errUnknownSQLCursor
+	}
+	delete(s.cursors, id)
+	return cursor, nil
+}
+
+func (s *sqlCursorStore) put(cursor *sqlCursor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.cursors) >= s.cfg.MaxCursors {
+		return fmt.Errorf("too many open cursors (maximum %d)", s.cfg.MaxCursors)
+	}
+	cursor.expires = time.Now().Add(s.cfg.KeepAlive)
+	s.cursors[cursor.id] = cursor
+	return nil
+}
+
+// sweep forgets the cursors that expired. Elasticsearch drops them on its
+// own once their page timeout lapses.
+func (s *sqlCursorStore) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, cursor := range s.cursors {
+		if now.After(cursor.expires) {
+			delete(s.cursors, id)
+		}
+	}
+}
+
+var errUnknownSQLCursor = errors.New("unknown or expired cursor, run the SQL query again")
+
+// sqlTables returns the tables (index patterns) an SQL query reads from: the
+// table after every FROM keyword outside strings, comments and EXTRACT
+// function calls. Subqueries are covered by their own FROM.
+func sqlTables(query string) []string {
+	var (
+		tables []string
+		parens []string
+		word   string
+	)
+
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '\'' || ch == '"' || ch == '`':
+			j := i + 1
+			for j < len(query) && query[j] != ch {
+				j++
+			}
+			i, word = j, ""
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			i, word = i+end, ""
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query) - i - 2
+			}
+			i, word = i+end+3, ""
+		case isSQLWordChar(ch):
+			j := i
+			for j < len(query) && isSQLWordChar(query[j]) {
+				j++
+			}
+			word = strings.ToLower(query[i:j])
+			i = j - 1
+
+			inExtract := len(parens) > 0 && parens[len(parens)-1] == "extract"
+			if word == "from" && !inExtract {
+				table, end := sqlTable(query, j)
+				if table != "" {
+					tables = append(tables, table)
+				}
+				i, word = end-1, ""
+			}
+		case ch == '(':
+			parens = append(parens, word)
+			word = ""
+		case ch == ')':
+			if len(parens) > 0 {
+				parens = parens[:len(parens)-1]
+			}
+			word = ""
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n':
+		default:
+			word = ""
+		}
+	}
+
+	return tables
+}
+
+// sqlTable parses the table identifier starting at or after position i of
+// query, returning it and the position following it. A subquery has no
+// table of its own.
+func sqlTable(query string, i int) (string, int) {
+	for i < len(query) && strings.IndexByte(" \t\r\n", query[i]) >= 0 {
+		i++
+	}
+	if i >= len(query) || query[i] == '(' {
+		return "", i
+	}
+
+	if quote := query[i]; quote == '"' || quote == '`' {
+		end := strings.IndexByte(query[i+1:], quote)
+		if end < 0 {
+			return query[i+1:], len(query)
+		}
+		return query[i+1 : i+1+end], i + end + 2
+	}
+
+	end := i
+	for end < len(query) && strings.IndexByte(" \t\r\n,();", query[end]) < 0 {
+		end++
+	}
+	return query[i:end], end
+}
+
+func isSQLWordChar(ch byte) bool {
+	return ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9'
+}
+
+// sqlQuery runs an SQL query, or fetches the next page of a cursor.
+func (c *cluster) sqlQuery(ctx context.Context, body []byte) (*SQLResponse, error) {
+	res, err := c.client.SQL.Query(
+		strings.NewReader(string(body)),
+		c.client.SQL.Query.WithContext(ctx),
+		c.client.SQL.Query.WithFormat("json"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var sqlResponse SQLResponse
+	if err := json.NewDecoder(res.Body).Decode(&sqlResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &sqlResponse, nil
+}
+
+// sqlTranslate returns the query DSL equivalent to an SQL query.
+func (c *cluster) sqlTranslate(ctx context.Context, body []byte) (map[string]any, error) {
+	res, err := c.client.SQL.Translate(
+		strings.NewReader(string(body)),
+		c.client.SQL.Translate.WithContext(ctx),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var dsl map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&dsl); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return dsl, nil
+}
+
+// clearSQLCursor releases an SQL cursor. Failures are only logged:
+// Elasticsearch drops the cursor once its page timeout lapses anyway.
+func (h *ElasticsearchHandler) clearSQLCursor(c *cluster, esCursor string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	body, err := json.Marshal(map[string]string{"cursor": esCursor})
+	if err != nil {
+		return
+	}
+
+	res, err := c.client.SQL.ClearCursor(
+		strings.NewReader(string(body)),
+		c.client.SQL.ClearCursor.WithContext(ctx),
+	)
+	if err != nil {
+		h.logger.Warn().Err(err).Str("cluster", c.name).Msg("Failed to clear SQL cursor")
+		return
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		h.logger.Warn().Str("cluster", c.name).Str("response", res.String()).Msg("Failed to clear SQL cursor")
+	}
+}
+
+func (h *ElasticsearchHandler) handleSQL(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	if id := request.GetString("cursor", ""); id != "" {
+		return h.handleSQLPage(ctx, request, id)
+	}
+
+	log := h.requestLogger(ctx)
+
+	query, err := request.RequireString("query")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing query parameter")
+		return mcp.NewToolResultError("Missing 'query' parameter"), nil
+	}
+
+	c, err := h.clusterFor(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, budget, err := h.queryBudget(ctx, "sql", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
+	fetchSize := request.GetInt("fetch_size", h.sql.MaxFetchSize)
+	if fetchSize <= 0 {
+		return mcp.NewToolResultError("fetch_size must be greater than 0"), nil
+	}
+	fetchSize = min(fetchSize, h.sql.MaxFetchSize)
+	translate := request.GetBool("translate", false)
+
+	log.Info().Str("query", query).Bool("translate", translate).Msg("Executing SQL query")
+
+	// SHOW and DESCRIBE take LIKE patterns in SQL syntax that the index
+	// access rules cannot reason about, and list_indices and
+	// get_index_mappings already cover them.
+	if h.indexAccess.enabled() {
+		statement, _ := cutWord(strings.TrimSpace(query))
+		if !strings.EqualFold(statement, "select") {
+			return mcp.NewToolResultError(
+				"Only SELECT statements are supported while index access rules are configured; " +
+					"use list_indices and get_index_mappings to explore indices",
+			), nil
+		}
+	}
+	index := strings.Join(sqlTables(query), ",")
+	if index != "" {
+		if result := h.checkIndexAccess(ctx, log, c, index); result != nil {
+			return result, nil
+		}
+	}
+
+	sqlRequest := map[string]any{
+		"query":      query,
+		"fetch_size": fetchSize,
+	}
+	if paramsString := request.GetString("params", ""); paramsString != "" {
+		var params []any
+		if err := json.Unmarshal([]byte(paramsString), &params); err != nil {
+			log.Error().Err(err).Str("params", paramsString).Msg("Invalid params JSON")
+			return mcp.NewToolResultError(
+				fmt.Sprintf("Invalid params JSON, expected an array: %v", err),
+			), nil
+		}
+		sqlRequest["params"] = params
+	}
+	if timeZone := request.GetString("time_zone", ""); timeZone != "" {
+		sqlRequest["time_zone"] = timeZone
+	}
+
+	// terminate_after does not apply to SQL.
+	budgetResponse := budget.response()
+	delete(budgetResponse, "terminate_after")
+
+	auditRequest(ctx, index, sqlRequest)
+
+	if translate {
+		body, err := json.Marshal(sqlRequest)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to marshal SQL request")
+			return mcp.NewToolResultError("Failed to create SQL request"), nil
+		}
+
+		dsl, err := c.sqlTranslate(ctx, body)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to translate SQL query")
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to translate SQL query: %v", err)), nil
+		}
+
+		response := map[string]any{
+			"cluster": c.name,
+			"index":   index,
+			"query":   dsl,
+		}
+		jsonBytes, err := json.Marshal(response)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to marshal SQL translation")
+			return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+		}
+
+		log.Info().Msg("SQL query translated successfully")
+		return mcp.NewToolResultText(string(jsonBytes)), nil
+	}
+
+	// Translating a query reads no documents, running it does.
+	if result := h.checkRedactedSources(ctx, log, c, index, "SQL"); result != nil {
+		return result, nil
+	}
+
+	if budget.Timeout > 0 {
+		sqlRequest["request_timeout"] = esDuration(budget.Timeout)
+	}
+	sqlRequest["page_timeout"] = esDuration(h.sqlCursors.cfg.KeepAlive)
+
+	body, err := json.Marshal(sqlRequest)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal SQL request")
+		return mcp.NewToolResultError("Failed to create SQL request"), nil
+	}
+
+	sqlResponse, err := c.sqlQuery(ctx, body)
+	if err != nil {
+		return sqlErrorResult(log, budget, err), nil
+	}
+
+	cursor := &sqlCursor{
+		clientID: clientIdentityFromContext(ctx).ID,
+		cluster:  c.name,
+		index:    index,
+		columns:  sqlResponse.Columns,
+	}
+	response := h.sqlResult(log, c, cursor, sqlResponse)
+	response["budget"] = budgetResponse
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal SQL response")
+		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+	}
+
+	log.Info().
+		Int("rows", len(sqlResponse.Rows)).
+		Bool("has_more", sqlResponse.Cursor != "").
+		Msg("SQL query executed successfully")
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
+
+// handleSQLPage returns the next page of an SQL cursor returned by a previous
+// call.
+func (h *ElasticsearchHandler) handleSQLPage(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+	id string,
+) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+	h.sqlCursors.sweep()
+
+	cursor, err := h.sqlCursors.take(id, clientIdentityFromContext(ctx).ID)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	c, ok := h.clusters[cursor.cluster]
+	if !ok {
+		return mcp.NewToolResultError(errUnknownSQLCursor.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, budget, err := h.queryBudget(ctx, "sql", request)
+	if err != nil {
+		h.restoreSQLCursor(log, c, cursor)
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
+	log.Info().Str("index", cursor.index).Msg("Fetching next SQL page")
+	auditRequest(ctx, cursor.index, nil)
+
+	sqlRequest := map[string]any{
+		"cursor":       cursor.esCursor,
+		"page_timeout": esDuration(h.sqlCursors.cfg.KeepAlive),
+	}
+	if budget.Timeout > 0 {
+		sqlRequest["request_timeout"] = esDuration(budget.Timeout)
+	}
+	body, err := json.Marshal(sqlRequest)
+	if err != nil {
+		h.restoreSQLCursor(log, c, cursor)
+		log.Error().Err(err).Msg("Failed to marshal SQL request")
+		return mcp.NewToolResultError("Failed to create SQL request"), nil
+	}
+
+	sqlResponse, err := c.sqlQuery(ctx, body)
+	if err != nil {
+		// Keep the cursor so that the page can be retried.
+		h.restoreSQLCursor(log, c, cursor)
+		return sqlErrorResult(log, budget, err), nil
+	}
+
+	response := h.sqlResult(log, c, cursor, sqlResponse)
+	budgetResponse := budget.response()
+	delete(budgetResponse, "terminate_after")
+	response["budget"] = budgetResponse
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal SQL response")
+		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+	}
+
+	log.Info().
+		Int("rows", len(sqlResponse.Rows)).
+		Bool("has_more", sqlResponse.Cursor != "").
+		Msg("SQL page fetched successfully")
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
+
+// sqlResult builds the tool response for a page of SQL results, storing the
+// cursor for the next page when there is one.
+func (h *ElasticsearchHandler) sqlResult(
+	log zerolog.Logger,
+	c *cluster,
+	cursor *sqlCursor,
+	sqlResponse *SQLResponse,
+) map[string]any {
+	rows := sqlResponse.Rows
+	if rows == nil {
+		rows = [][]any{}
+	}
+
+	response := map[string]any{
+		"cluster":   c.name,
+		"columns":   cursor.columns,
+		"rows":      rows,
+		"row_count": len(rows),
+		"cursor":    nil,
+		"has_more":  false,
+	}
+	if cursor.index != "" {
+		response["index"] = cursor.index
+	}
+
+	if sqlResponse.Cursor == "" {
+		return response
+	}
+	response["has_more"] = true
+
+	h.sqlCursors.sweep()
+	id, err := newCursorID()
+	if err == nil {
+		cursor.id = id
+		cursor.esCursor = sqlResponse.Cursor
+		err = h.sqlCursors.put(cursor)
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to store SQL cursor")
+		h.clearSQLCursor(c, sqlResponse.Cursor)
+		response["cursor_error"] = err.Error()
+		return response
+	}
+
+	response["cursor"] = cursor.id
+	return response
+}
+
+// restoreSQLCursor puts back a cursor whose page could not be fetched.
+func (h *ElasticsearchHandler) restoreSQLCursor(log zerolog.Logger, c *cluster, cursor *sqlCursor) {
+	if err := h.sqlCursors.put(cursor); err != nil {
+		log.Warn().Err(err).Msg("Failed to store SQL cursor")
+		h.clearSQLCursor(c, cursor.esCursor)
+	}
+}
+
+func sqlErrorResult(log zerolog.Logger, budget queryBudget, err error) *mcp.CallToolResult {
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Warn().Dur("timeout", budget.Timeout).Msg("SQL query exceeded its timeout")
+		return mcp.NewToolResultError(fmt.Sprintf(
+			"SQL query did not complete within its %s timeout; narrow the query or lower its fetch_size",
+			budget.Timeout,
+		))
+	}
+	log.Error().Err(err).Msg("Failed to execute SQL query")
+	return mcp.NewToolResultError(fmt.Sprintf("Failed to execute SQL query: %v", err))
+}
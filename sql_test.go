@@ -0,0 +1,32 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSQLTables(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: `SELECT * FROM logs`, want: []string{"logs"}},
+		{query: `SELECT * FROM "logs-*" WHERE level = 'ERROR'`, want: []string{"logs-*"}},
+		{query: "SELECT * FROM `logs-app`", want: []string{"logs-app"}},
+		{query: `select count(*) from logs-2024.01 group by host`, want: []string{"logs-2024.01"}},
+		{query: `SELECT * FROM (SELECT * FROM users) u`, want: []string{"users"}},
+		{query: `SELECT EXTRACT(YEAR FROM ts) FROM logs`, want: []string{"logs"}},
+		{query: `SELECT 'FROM secret' FROM logs`, want: []string{"logs"}},
+		{query: "SELECT * FROM logs -- FROM secret", want: []string{"logs"}},
+		{query: "SELECT * FROM logs /* FROM secret */", want: []string{"logs"}},
+		{query: `SELECT 1`, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := sqlTables(tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sqlTables() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
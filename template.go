@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// mustacheFunctions are the section names Elasticsearch treats as
+// functions; the text they wrap names the parameter.
+var mustacheFunctions = map[string]bool{"toJson": true, "join": true, "url": true}
+
+// templateParam is a parameter a search template expects.
+type templateParam struct {
+	Name string `json:"name"`
+	// Default is the value of an inverted section following the
+	// parameter, as in {{size}}{{^size}}10{{/size}}.
+	Default string `json:"default,omitempty"`
+}
+
+// templateParams returns the parameters a mustache template refers to.
+// Names inside sections are listed as well: a section over an object or a
+// list refers to its fields, but one over a plain value falls back to the
+// template's parameters.
+func templateParams(source string) []templateParam {
+	defaults := make(map[string]string)
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if name != "" && name != "." {
+			seen[name] = true
+		}
+	}
+
+	rest := source
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			break
+		}
+		rest = rest[start+2:]
+
+		closing := "}}"
+		if strings.HasPrefix(rest, "{") {
+			rest = rest[1:]
+			closing = "}}}"
+		}
+		end := strings.Index(rest, closing)
+		if end < 0 {
+			break
+		}
+		tag := strings.TrimSpace(rest[:end])
+		rest = rest[end+len(closing):]
+
+		if tag == "" {
+			continue
+		}
+		switch kind, name := tag[0], strings.TrimSpace(tag[1:]); kind {
+		case '!', '/', '>', '=':
+			// Comments, section ends, partials and delimiter changes.
+		case '&':
+			add(name)
+		case '#':
+			// {{#join delimiter='||'}}tags{{/join delimiter='||'}} repeats its
+			// arguments in the closing tag.
+			function, _, _ := strings.Cut(name, " ")
+			if !mustacheFunctions[function] {
+				add(name)
+				continue
+			}
+			if inner, _, ok := strings.Cut(rest, "{{/"+function); ok && !strings.Contains(inner, "{{") {
+				add(strings.TrimSpace(inner))
+			}
+		case '^':
+			add(name)
+			if inner, _, ok := strings.Cut(rest, "{{/"+name+"}}"); ok && !strings.Contains(inner, "{{") {
+				defaults[name] = inner
+			}
+		default:
+			add(tag)
+		}
+	}
+
+	params := make([]templateParam, 0, len(seen))
+	for name := range seen {
+		params = append(params, templateParam{Name: name, Default: defaults[name]})
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+	return params
+}
+
+// searchTemplates returns the stored mustache scripts of the cluster by id.
+func (c *cluster) searchTemplates(ctx context.Context) (map[string]string, error) {
+	res, err := c.client.Cluster.State(
+		c.client.Cluster.State.WithContext(ctx),
+		c.client.Cluster.State.WithMetric("metadata"),
+		c.client.Cluster.State.WithFilterPath("metadata.stored_scripts"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var state struct {
+		Metadata struct {
+			StoredScripts map[string]struct {
+				Lang   string `json:"lang"`
+				Source string `json:"source"`
+			} `json:"stored_scripts"`
+		} `json:"metadata"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	templates := make(map[string]string)
+	for id, script := range state.Metadata.StoredScripts {
+		if script.Lang == "mustache" {
+			templates[id] = script.Source
+		}
+	}
+	return templates, nil
+}
+
+// renderSearchTemplate renders a stored search template with params into
+// a search body.
+func (c *cluster) renderSearchTemplate(
+	ctx context.Context,
+	id string,
+	params map[string]any,
+) (map[string]any, error) {
+	body, err := json.Marshal(map[string]any{"params": params})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.client.RenderSearchTemplate(
+		c.client.RenderSearchTemplate.WithContext(ctx),
+		c.client.RenderSearchTemplate.WithTemplateID(id),
+		c.client.RenderSearchTemplate.WithBody(strings.NewReader(string(body))),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("search template %q not found", id)
+	}
+	if res.IsError() {
+		return nil, fmt.Errorf("elasticsearch error: %s", res.String())
+	}
+
+	var rendered struct {
+		TemplateOutput map[string]any `json:"template_output"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&rendered); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return rendered.TemplateOutput, nil
+}
+
+// templateParamsArgument reads the params argument of the template tools.
+func templateParamsArgument(request mcp.CallToolRequest) (map[string]any, error) {
+	params := map[string]any{}
+	if paramsString := request.GetString("params", ""); paramsString != "" {
+		if err := json.Unmarshal([]byte(paramsString), &params); err != nil {
+			return nil, fmt.Errorf("invalid params JSON, expected an object: %w", err)
+		}
+	}
+	return params, nil
+}
+
+func (h *ElasticsearchHandler) handleListSearchTemplates(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+
+	c, err := h.clusterFor(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, _, err := h.queryBudget(ctx, "list_search_templates", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
+	log.Info().Msg("Listing search templates")
+
+	templates, err := c.searchTemplates(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list search templates")
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to list search templates: %v", err)), nil
+	}
+
+	list := make([]map[string]any, 0, len(templates))
+	for _, id := range sortedKeys(templates) {
+		list = append(list, map[string]any{
+			"id":     id,
+			"params": templateParams(templates[id]),
+			"source": templates[id],
+		})
+	}
+
+	response := map[string]any{
+		"cluster":   c.name,
+		"templates": list,
+		"count":     len(list),
+	}
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal search templates response")
+		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+	}
+
+	log.Info().Int("count", len(list)).Msg("Listed search templates successfully")
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
+
+func (h *ElasticsearchHandler) handleRenderSearchTemplate(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+
+	id, err := request.RequireString("id")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing id parameter")
+		return mcp.NewToolResultError("Missing 'id' parameter"), nil
+	}
+	params, err := templateParamsArgument(request)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid params JSON")
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	c, err := h.clusterFor(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, _, err := h.queryBudget(ctx, "render_search_template", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
+	log.Info().Str("id", id).Msg("Rendering search template")
+	auditRequest(ctx, "", map[string]any{"id": id, "params": params})
+
+	rendered, err := c.renderSearchTemplate(ctx, id, params)
+	if err != nil {
+		log.Error().Err(err).Str("id", id).Msg("Failed to render search template")
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to render search template: %v", err)), nil
+	}
+
+	response := map[string]any{
+		"cluster":  c.name,
+		"id":       id,
+		"rendered": rendered,
+	}
+	// Surface the rejection now rather than when the template is run.
+	if violation := h.policy.check(rendered); violation != nil {
+		response["policy_violation"] = violation
+	}
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal rendered template")
+		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+	}
+
+	log.Info().Str("id", id).Msg("Search template rendered successfully")
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
+
+func (h *ElasticsearchHandler) handleSearchTemplate(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+
+	index, err := request.RequireString("index")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing index parameter")
+		return mcp.NewToolResultError("Missing 'index' parameter"), nil
+	}
+	id, err := request.RequireString("id")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing id parameter")
+		return mcp.NewToolResultError("Missing 'id' parameter"), nil
+	}
+	params, err := templateParamsArgument(request)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid params JSON")
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	c, err := h.clusterFor(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, budget, err := h.queryBudget(ctx, "search_template", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
+	log.Info().Str("index", index).Str("id", id).Msg("Executing search template")
+
+	if result := h.checkIndexAccess(ctx, log, c, index); result != nil {
+		return result, nil
+	}
+
+	// The template is rendered first so that the search policy sees the
+	// search that is about to run.
+	rendered, err := c.renderSearchTemplate(ctx, id, params)
+	if err != nil {
+		log.Error().Err(err).Str("id", id).Msg("Failed to render search template")
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to render search template: %v", err)), nil
+	}
+	if violation := h.policy.check(rendered); violation != nil {
+		log.Warn().
+			Str("index", index).
+			Str("id", id).
+			Str("rule", violation.Rule).
+			Str("path", violation.Path).
+			Msg("Search template rejected by policy")
+		return violation.toolResult(), nil
+	}
+
+	// The rendered body runs as a regular search, so the search that runs is
+	// the one the policy checked, whatever happens to the stored template.
+	searchResponse, errResult := h.executeSearch(ctx, log, c, index, rendered, budget, true)
+	if errResult != nil {
+		return errResult, nil
+	}
+
+	if errResult := h.redactSearchResponse(ctx, log, c, searchResponse, rendered); errResult != nil {
+		return errResult, nil
+	}
+
+	response := searchResult(c, index, searchResponse, budget)
+	response["id"] = id
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal search template response")
+		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+	}
+
+	log.Info().
+		Str("index", index).
+		Str("id", id).
+		Int("total_hits", searchResponse.Hits.Total.Value).
+		Int("returned_hits", len(searchResponse.Hits.Hits)).
+		Int("took_ms", searchResponse.Took).
+		Msg("Search template executed successfully")
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
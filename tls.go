@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// hasTLSSettings reports whether the cluster overrides the default TLS
+// behaviour of the Elasticsearch client.
+func (cfg ElasticsearchConfig) hasTLSSettings() bool {
+	return cfg.CACertFile != "" ||
+		cfg.CAFingerprint != "" ||
+		cfg.ClientCertFile != "" ||
+		cfg.ClientKeyFile != "" ||
+		cfg.InsecureSkipVerify
+}
+
+// newTLSConfig builds the TLS client configuration of a cluster from its CA
+// bundle, pinned fingerprint, client certificate and skip-verify settings.
+func newTLSConfig(cfg ElasticsearchConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CACertFile != "" {
+		pem, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in CA file %s", cfg.CACertFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	if cfg.ClientCertFile != "" || cfg.ClientKeyFile != "" {
+		if cfg.ClientCertFile == "" || cfg.ClientKeyFile == "" {
+			return nil, fmt.Errorf("client certificate and client key must be provided together")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.CAFingerprint != "" {
+		fingerprint, err := parseFingerprint(cfg.CAFingerprint)
+		if err != nil {
+			return nil, err
+		}
+		// The pinned certificate replaces the system roots: the server's
+		// chain must lead to the certificate matching the fingerprint, as
+		// presenting that certificate alone proves nothing.
+		tlsCfg.InsecureSkipVerify = true
+		tlsCfg.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyPinnedChain(state, fingerprint)
+		}
+	}
+
+	if cfg.InsecureSkipVerify {
+		tlsCfg.InsecureSkipVerify = true
+	}
+
+	return tlsCfg, nil
+}
+
+// verifyPinnedChain verifies the server's certificate chain against the
+// certificate it presents whose SHA-256 digest is fingerprint.
+func verifyPinnedChain(state tls.ConnectionState, fingerprint []byte) error {
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("server presented no certificate")
+	}
+
+	roots := x509.NewCertPool()
+	intermediates := x509.NewCertPool()
+	pinned := false
+	for _, cert := range state.PeerCertificates {
+		digest := sha256.Sum256(cert.Raw)
+		if bytes.Equal(digest[:], fingerprint) {
+			roots.AddCert(cert)
+			pinned = true
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+	if !pinned {
+		return fmt.Errorf("no server certificate matches the pinned fingerprint")
+	}
+
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       state.ServerName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		return fmt.Errorf("server certificate does not chain to the pinned certificate: %w", err)
+	}
+	return nil
+}
+
+// newHTTPTransport returns a copy of the default HTTP transport using the
+// cluster's TLS configuration.
+func newHTTPTransport(cfg ElasticsearchConfig) (*http.Transport, error) {
+	tlsCfg, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+	return transport, nil
+}
+
+// parseFingerprint decodes a hex SHA-256 fingerprint, accepting the
+// colon-separated form printed by openssl and Elasticsearch.
+func parseFingerprint(value string) ([]byte, error) {
+	fingerprint, err := hex.DecodeString(strings.ReplaceAll(value, ":", ""))
+	if err != nil || len(fingerprint) != sha256.Size {
+		return nil, fmt.Errorf("CA fingerprint must be a hex encoded SHA-256 digest")
+	}
+	return fingerprint, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/rs/zerolog"
+)
+
+const (
+	transportStdio          = "stdio"
+	transportSSE            = "sse"
+	transportStreamableHTTP = "streamable-http"
+)
+
+// serve exposes the MCP server over the transport selected in the server
+// configuration and blocks until the transport stops or ctx is cancelled.
+func serve(
+	ctx context.Context,
+	s *server.MCPServer,
+	cfg ServerConfig,
+	auth Authenticator,
+	logger zerolog.Logger,
+) error {
+	log := logger.With().Str("component", "transport").Str("transport", cfg.Transport).Logger()
+
+	switch cfg.Transport {
+	case transportStdio:
+		log.Info().Msg("MCP Elasticsearch server initialized, serving on stdio")
+		return serveStdio(ctx, s)
+	case transportSSE:
+		return serveSSE(ctx, s, cfg, auth, log)
+	case transportStreamableHTTP:
+		return serveStreamableHTTP(ctx, s, cfg, auth, log)
+	default:
+		return fmt.Errorf("unsupported transport: %s", cfg.Transport)
+	}
+}
+
+func serveStdio(ctx context.Context, s *server.MCPServer) error {
+	err := server.NewStdioServer(s).Listen(ctx, os.Stdin, os.Stdout)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+func serveSSE(
+	ctx context.Context,
+	s *server.MCPServer,
+	cfg ServerConfig,
+	auth Authenticator,
+	log zerolog.Logger,
+) error {
+	httpServer := &http.Server{Addr: cfg.ListenAddr}
+
+	opts := []server.SSEOption{
+		server.WithStaticBasePath(cfg.BasePath),
+		server.WithHTTPServer(httpServer),
+		server.WithKeepAlive(true),
+	}
+	if cfg.PublicURL != "" {
+		opts = append(opts, server.WithBaseURL(cfg.PublicURL))
+	}
+
+	sseServer := server.NewSSEServer(s, opts...)
+	httpServer.Handler = authMiddleware(auth, sseServer, log)
+
+	log.Info().
+		Str("listen_addr", cfg.ListenAddr).
+		Bool("auth_enabled", auth != nil).
+		Str("sse_path", sseServer.CompleteSsePath()).
+		Str("message_path", sseServer.CompleteMessagePath()).
+		Msg("MCP Elasticsearch server initialized, serving on SSE")
+
+	return runHTTP(ctx, func() error {
+		return sseServer.Start(cfg.ListenAddr)
+	}, sseServer.Shutdown, cfg.ShutdownTimeout, log)
+}
+
+func serveStreamableHTTP(
+	ctx context.Context,
+	s *server.MCPServer,
+	cfg ServerConfig,
+	auth Authenticator,
+	log zerolog.Logger,
+) error {
+	mux := http.NewServeMux()
+	mux.Handle(cfg.BasePath, authMiddleware(auth, server.NewStreamableHTTPServer(s), log))
+
+	httpServer := &http.Server{
+		Addr:    cfg.ListenAddr,
+		Handler: mux,
+	}
+
+	log.Info().
+		Str("listen_addr", cfg.ListenAddr).
+		Bool("auth_enabled", auth != nil).
+		Str("endpoint_path", cfg.BasePath).
+		Msg("MCP Elasticsearch server initialized, serving on streamable HTTP")
+
+	return runHTTP(ctx, httpServer.ListenAndServe, httpServer.Shutdown, cfg.ShutdownTimeout, log)
+}
+
+// runHTTP starts an HTTP-based transport and shuts it down gracefully once ctx
+// is cancelled, giving in-flight requests up to timeout to complete.
+func runHTTP(
+	ctx context.Context,
+	start func() error,
+	shutdown func(context.Context) error,
+	timeout time.Duration,
+	log zerolog.Logger,
+) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- start()
+	}()
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Info().Dur("timeout", timeout).Msg("Shutting down HTTP transport")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("error shutting down HTTP transport: %w", err)
+	}
+
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	log.Info().Msg("HTTP transport stopped")
+	return nil
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/rs/zerolog"
+)
+
+// maxExplanationLines caps the lines of a rendered score explanation.
+const maxExplanationLines = 200
+
+type ValidateQueryResponse struct {
+	Valid        bool `json:"valid"`
+	Explanations []struct {
+		Index       string `json:"index"`
+		Shard       *int   `json:"shard,omitempty"`
+		Valid       bool   `json:"valid"`
+		Explanation string `json:"explanation,omitempty"`
+		Error       string `json:"error,omitempty"`
+	} `json:"explanations"`
+	Error string `json:"error,omitempty"`
+}
+
+type Explanation struct {
+	Value       float64       `json:"value"`
+	Description string        `json:"description"`
+	Details     []Explanation `json:"details"`
+}
+
+type ExplainResponse struct {
+	Index       string       `json:"_index"`
+	ID          string       `json:"_id"`
+	Matched     bool         `json:"matched"`
+	Explanation *Explanation `json:"explanation"`
+}
+
+// lines renders the explanation tree as indented "value = description"
+// lines, at most max of them.
+func (e *Explanation) lines(depth int, out []string, max int) []string {
+	if len(out) >= max {
+		return out
+	}
+	out = append(out, fmt.Sprintf("%s%g = %s", strings.Repeat("  ", depth), e.Value, e.Description))
+	for i := range e.Details {
+		out = e.Details[i].lines(depth+1, out, max)
+	}
+	return out
+}
+
+// size returns the number of nodes of the explanation tree.
+func (e *Explanation) size() int {
+	n := 1
+	for i := range e.Details {
+		n += e.Details[i].size()
+	}
+	return n
+}
+
+func (h *ElasticsearchHandler) handleValidateQuery(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+
+	index, err := request.RequireString("index")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing index parameter")
+		return mcp.NewToolResultError("Missing 'index' parameter"), nil
+	}
+
+	c, err := h.clusterFor(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, _, err := h.queryBudget(ctx, "validate_query", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
+	queryString := request.GetString("query", "{}")
+	rewrite := request.GetBool("rewrite", true)
+	allShards := request.GetBool("all_shards", false)
+
+	log.Info().Str("index", index).Str("query", queryString).Msg("Validating query")
+
+	if result := h.checkIndexAccess(ctx, log, c, index); result != nil {
+		return result, nil
+	}
+
+	// A query that is not even JSON is reported as invalid rather than as a
+	// tool error, like any other invalid query.
+	query, err := parseQuery(queryString)
+	if err != nil {
+		return validationResult(log, map[string]any{
+			"cluster": c.name,
+			"index":   index,
+			"valid":   false,
+			"error":   fmt.Sprintf("invalid query JSON: %v", err),
+		})
+	}
+	validateRequest := map[string]any{"query": query}
+
+	auditRequest(ctx, index, validateRequest)
+
+	body, err := json.Marshal(validateRequest)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal validation request")
+		return mcp.NewToolResultError("Failed to create validation request"), nil
+	}
+
+	res, err := c.client.Indices.ValidateQuery(
+		c.client.Indices.ValidateQuery.WithContext(ctx),
+		c.client.Indices.ValidateQuery.WithIndex(index),
+		c.client.Indices.ValidateQuery.WithBody(strings.NewReader(string(body))),
+		c.client.Indices.ValidateQuery.WithExplain(true),
+		c.client.Indices.ValidateQuery.WithRewrite(rewrite),
+		c.client.Indices.ValidateQuery.WithAllShards(allShards && rewrite),
+	)
+	if err != nil {
+		log.Error().Err(err).Str("index", index).Msg("Failed to validate query")
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to validate query: %v", err)), nil
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		log.Error().Str("response", res.String()).Msg("Elasticsearch validation error")
+		return mcp.NewToolResultError(fmt.Sprintf("Elasticsearch error: %s", res.String())), nil
+	}
+
+	var validateResponse ValidateQueryResponse
+	if err := json.NewDecoder(res.Body).Decode(&validateResponse); err != nil {
+		log.Error().Err(err).Msg("Failed to decode validation response")
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to decode response: %v", err)), nil
+	}
+
+	response := map[string]any{
+		"cluster":      c.name,
+		"index":        index,
+		"valid":        validateResponse.Valid,
+		"explanations": validateResponse.Explanations,
+	}
+	if validateResponse.Error != "" {
+		response["error"] = validateResponse.Error
+	}
+
+	// A query Elasticsearch accepts may still be one the search tool
+	// rejects.
+	if violation := h.policy.check(validateRequest); violation != nil {
+		response["valid"] = false
+		response["policy_violation"] = violation
+	}
+
+	return validationResult(log, response)
+}
+
+func validationResult(log zerolog.Logger, response map[string]any) (*mcp.CallToolResult, error) {
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal validation response")
+		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+	}
+
+	log.Info().Interface("valid", response["valid"]).Msg("Query validated successfully")
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
+
+func (h *ElasticsearchHandler) handleExplainDocument(
+	ctx context.Context,
+	request mcp.CallToolRequest,
+) (*mcp.CallToolResult, error) {
+	log := h.requestLogger(ctx)
+
+	index, err := request.RequireString("index")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing index parameter")
+		return mcp.NewToolResultError("Missing 'index' parameter"), nil
+	}
+	id, err := request.RequireString("id")
+	if err != nil {
+		log.Error().Err(err).Msg("Missing id parameter")
+		return mcp.NewToolResultError("Missing 'id' parameter"), nil
+	}
+
+	c, err := h.clusterFor(request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	log = log.With().Str("cluster", c.name).Logger()
+
+	ctx, cancel, _, err := h.queryBudget(ctx, "explain_document", request)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	defer cancel()
+
+	queryString := request.GetString("query", "{}")
+
+	log.Info().Str("index", index).Str("id", id).Str("query", queryString).Msg("Explaining document")
+
+	query, err := parseQuery(queryString)
+	if err != nil {
+		log.Error().Err(err).Str("query", queryString).Msg("Invalid query JSON")
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid query JSON: %v", err)), nil
+	}
+	explainRequest := map[string]any{"query": query}
+
+	if result := h.checkIndexAccess(ctx, log, c, index); result != nil {
+		return result, nil
+	}
+
+	// Score explanations quote field values, as in decay and
+	// field_value_factor functions, and cannot be redacted field by field.
+	// The index may be an alias or a data stream the rules name.
+	redacted, err := h.redactedIndex(ctx, c, index)
+	if err != nil {
+		log.Error().Err(err).Str("index", index).Msg("Failed to resolve indices for redaction")
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to resolve indices for redaction: %v", err)), nil
+	}
+	if redacted != "" {
+		log.Warn().Str("index", redacted).Msg("Explain refused on an index with redaction rules")
+		return explainRedactedResult(redacted), nil
+	}
+
+	if violation := h.policy.check(explainRequest); violation != nil {
+		log.Warn().
+			Str("index", index).
+			Str("rule", violation.Rule).
+			Str("path", violation.Path).
+			Msg("Explain rejected by policy")
+		return violation.toolResult(), nil
+	}
+
+	auditRequest(ctx, index, explainRequest)
+
+	body, err := json.Marshal(explainRequest)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal explain request")
+		return mcp.NewToolResultError("Failed to create explain request"), nil
+	}
+
+	res, err := c.client.Explain(
+		index,
+		id,
+		c.client.Explain.WithContext(ctx),
+		c.client.Explain.WithBody(strings.NewReader(string(body))),
+	)
+	if err != nil {
+		log.Error().Err(err).Str("index", index).Msg("Failed to explain document")
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to explain document: %v", err)), nil
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return mcp.NewToolResultError(
+			fmt.Sprintf("Document %q not found in index %q; explain needs a concrete index, not a pattern", id, index),
+		), nil
+	}
+	if res.IsError() {
+		log.Error().Str("response", res.String()).Msg("Elasticsearch explain error")
+		return mcp.NewToolResultError(fmt.Sprintf("Elasticsearch error: %s", res.String())), nil
+	}
+
+	var explainResponse ExplainResponse
+	if err := json.NewDecoder(res.Body).Decode(&explainResponse); err != nil {
+		log.Error().Err(err).Msg("Failed to decode explain response")
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to decode response: %v", err)), nil
+	}
+
+	response := map[string]any{
+		"cluster": c.name,
+		"index":   explainResponse.Index,
+		"id":      explainResponse.ID,
+		"matched": explainResponse.Matched,
+	}
+	if e := explainResponse.Explanation; e != nil {
+		lines := e.lines(0, nil, maxExplanationLines)
+		response["score"] = e.Value
+		response["explanation"] = strings.Join(lines, "\n")
+		response["explanation_truncated"] = e.size() > len(lines)
+	}
+
+	jsonBytes, err := json.Marshal(response)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal explain response")
+		return mcp.NewToolResultError("Failed to marshal result to JSON"), nil
+	}
+
+	log.Info().
+		Str("index", index).
+		Str("id", id).
+		Bool("matched", explainResponse.Matched).
+		Msg("Document explained successfully")
+	return mcp.NewToolResultText(string(jsonBytes)), nil
+}
+
+// explainRedactedResult refuses to explain a document of an index with
+// redaction rules.
+func explainRedactedResult(index string) *mcp.CallToolResult {
+	return mcp.NewToolResultError(fmt.Sprintf(
+		"Cannot explain documents of %q: field redaction rules apply to it and score explanations include field values",
+		index,
+	))
+}